@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+)
+
+// AccountStore is consulted by SASL to log clients in to accounts.
+type AccountStore interface {
+	// CheckPassword reports whether password is correct for the named
+	// account, returning the account's name as stored, which may differ in
+	// case from the one given.
+	CheckPassword(name, password string) (account string, ok bool)
+
+	// AccountForCertificate maps a client certificate, identified by its
+	// SHA-256 fingerprint, to the account it has been bound to.
+	AccountForCertificate(fingerprint string) (account string, found bool)
+}
+
+type fileAccount struct {
+	name         string
+	passwordHash []byte
+	fingerprint  []string
+}
+
+// FileAccountStore is an AccountStore read from a text file with one account
+// per line:
+//
+//	<name> <password hash> [<certificate sha256 fingerprint> ...]
+//
+// Blank lines and lines starting with '#' are ignored. A hash of "*" disables
+// password logins for the account.
+type FileAccountStore struct {
+	account map[string]*fileAccount
+}
+
+func LoadFileAccountStore(path string) (*FileAccountStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	store := &FileAccountStore{
+		account: make(map[string]*fileAccount),
+	}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected account name and password hash", path, lineNo)
+		}
+		account := &fileAccount{
+			name: fields[0],
+		}
+		if fields[1] != "*" {
+			account.passwordHash = []byte(fields[1])
+		}
+		for _, fp := range fields[2:] {
+			account.fingerprint = append(account.fingerprint, normalizeFingerprint(fp))
+		}
+		store.account[strings.ToLower(account.name)] = account
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.Replace(fp, ":", "", -1))
+}
+
+func (store *FileAccountStore) CheckPassword(name, password string) (string, bool) {
+	account, found := store.account[strings.ToLower(name)]
+	if !found || account.passwordHash == nil {
+		return "", false
+	}
+	if !CheckPasswordHash(string(account.passwordHash), password) {
+		return "", false
+	}
+	return account.name, true
+}
+
+// AccountForCertificate only accepts fingerprints listed for an account. The
+// certificate's subject isn't trusted on its own.
+func (store *FileAccountStore) AccountForCertificate(fingerprint string) (string, bool) {
+	fingerprint = normalizeFingerprint(fingerprint)
+	for _, account := range store.account {
+		for _, fp := range account.fingerprint {
+			if fp == fingerprint {
+				return account.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// MaxAuthFailures is how many failed SASL and OPER attempts a connection may
+// make before it is disconnected.
+const MaxAuthFailures = 3
+
+// Verify runs check, which may be slow, off the Run goroutine and then calls
+// done with its result back on it. Only one check runs per connection at a
+// time; callers must not start another while conn.verifying is set.
+func (ircd *Ircd) Verify(conn *IrcConnection, check func() bool, done func(ok bool)) {
+	conn.verifying = true
+	go func() {
+		ok := check()
+		select {
+		case conn.recv <- IrcConnectionEvent{
+			Connection: conn,
+			Message:    &VerifiedIrcClientMessage{func() { done(ok) }},
+		}:
+		case <-conn.exit:
+		}
+	}()
+}
+
+// AuthFailed counts a failed login attempt, disconnecting the connection and
+// returning true once it has made too many.
+func (ircd *Ircd) AuthFailed(conn *IrcConnection) bool {
+	conn.authFailures++
+	if conn.authFailures < MaxAuthFailures {
+		return false
+	}
+	ircd.Disconnect(conn, "Too many failed authentication attempts")
+	return true
+}
+
+// CheckPasswordHash reports whether password matches a bcrypt hash or an
+// argon2i/argon2id hash in the PHC string format:
+//
+//	$argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<hash>
+func CheckPasswordHash(hash, password string) bool {
+	if !strings.HasPrefix(hash, "$argon2") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil || iterations == 0 || threads == 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+	var got []byte
+	switch parts[1] {
+	case "argon2id":
+		got = argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	case "argon2i":
+		got = argon2.Key([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// phcHash encodes an argon2 hash of password in the PHC string format.
+func phcHash(variant, password string) string {
+	salt := []byte("0123456789abcdef")
+	var key []byte
+	if variant == "argon2id" {
+		key = argon2.IDKey([]byte(password), salt, 1, 64, 1, 32)
+	} else {
+		key = argon2.Key([]byte(password), salt, 1, 64, 1, 32)
+	}
+	return fmt.Sprintf("$%s$v=%d$m=64,t=1,p=1$%s$%s", variant, argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		ok       bool
+	}{
+		{"bcrypt", string(bcryptHash), "hunter2", true},
+		{"bcrypt wrong password", string(bcryptHash), "hunter3", false},
+		{"argon2id", phcHash("argon2id", "hunter2"), "hunter2", true},
+		{"argon2id wrong password", phcHash("argon2id", "hunter2"), "hunter3", false},
+		{"argon2i", phcHash("argon2i", "hunter2"), "hunter2", true},
+		{"argon2d", "$argon2d$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", "hunter2", false},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA", "hunter2", false},
+		{"no threads", "$argon2id$v=19$m=64,t=1,p=0$c2FsdA$aGFzaA", "hunter2", false},
+		{"bad parameters", "$argon2id$v=19$m=64$c2FsdA$aGFzaA", "hunter2", false},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!$aGFzaA", "hunter2", false},
+		{"too few fields", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", "hunter2", false},
+		{"plain text", "hunter2", "hunter2", false},
+		{"empty", "", "", false},
+	}
+	for _, test := range tests {
+		if got := CheckPasswordHash(test.hash, test.password); got != test.ok {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.ok)
+		}
+	}
+}
+
+func TestFileAccountStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.txt")
+	accounts := fmt.Sprintf("# comment\n\nAlice %s AA:BB:CC\nbob * dd:ee\n", phcHash("argon2id", "hunter2"))
+	if err := os.WriteFile(path, []byte(accounts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadFileAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwords := []struct {
+		name, password, account string
+		ok                      bool
+	}{
+		{"alice", "hunter2", "Alice", true},
+		{"ALICE", "hunter2", "Alice", true},
+		{"alice", "wrong", "", false},
+		{"bob", "", "", false},
+		{"carol", "hunter2", "", false},
+	}
+	for _, test := range passwords {
+		account, ok := store.CheckPassword(test.name, test.password)
+		if account != test.account || ok != test.ok {
+			t.Errorf("CheckPassword(%q, %q) = %q, %v, want %q, %v", test.name, test.password, account, ok, test.account, test.ok)
+		}
+	}
+
+	fingerprints := []struct {
+		fingerprint, account string
+		found                bool
+	}{
+		{"aabbcc", "Alice", true},
+		{"AA:BB:CC", "Alice", true},
+		{"ddee", "bob", true},
+		{"ff", "", false},
+	}
+	for _, test := range fingerprints {
+		account, found := store.AccountForCertificate(test.fingerprint)
+		if account != test.account || found != test.found {
+			t.Errorf("AccountForCertificate(%q) = %q, %v, want %q, %v", test.fingerprint, account, found, test.account, test.found)
+		}
+	}
+}
+
+func TestLoadFileAccountStoreErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.txt")
+	if err := os.WriteFile(path, []byte("alice\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFileAccountStore(path); err == nil {
+		t.Errorf("accepted an account without a password hash")
+	}
+	if _, err := LoadFileAccountStore(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("accepted a missing file")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CapSet is the set of IRCv3 capabilities a connection has enabled.
+type CapSet map[string]bool
+
+func (caps CapSet) Has(name string) bool {
+	return caps[name]
+}
+
+// capTokens lists the capabilities currently offered, in CAP LS form. Values
+// are only included for clients that asked for CAP LS 302 or later.
+func (ircd *Ircd) capTokens(withValues bool) []string {
+	tokens := make([]string, 0, len(ircd.caps))
+	for name, value := range ircd.caps {
+		if withValues && value != "" {
+			tokens = append(tokens, name+"="+value)
+		} else {
+			tokens = append(tokens, name)
+		}
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// sendCapList sends a CAP LS or LIST reply. Clients that negotiated 302 get
+// the list split across lines, all but the last marked with "*"; older
+// clients get everything on a single line.
+func (ircd *Ircd) sendCapList(conn *IrcConnection, to, subcommand string, tokens []string) {
+	if conn.capVersion < 302 {
+		conn.Send(&IrcCapMessage{To: to, Subcommand: subcommand, Caps: tokens})
+		return
+	}
+	line := IrcCapMessage{To: to, Subcommand: subcommand, More: true}
+	for _, token := range tokens {
+		next := IrcCapMessage{To: to, Subcommand: subcommand, Caps: append(line.Caps, token), More: true}
+		if len(line.Caps) > 0 && len(next.ToIrc(ircd)) > MaxIrcLineLen {
+			conn.Send(&line)
+			next.Caps = []string{token}
+		}
+		line = next
+	}
+	line.More = false
+	conn.Send(&line)
+}
+
+// HandleCap processes a CAP command, before or after registration. Holding
+// registration open while negotiation is in progress is up to the caller.
+func (ircd *Ircd) HandleCap(conn *IrcConnection, to string, msg *CapIrcClientMessage) {
+	switch msg.Subcommand {
+	case "LS":
+		version, _ := strconv.Atoi(msg.Arg)
+		if version > conn.capVersion {
+			conn.capVersion = version
+		}
+		if conn.capVersion >= 302 {
+			// cap-notify is implicitly enabled for 302 clients.
+			conn.caps["cap-notify"] = true
+		}
+		ircd.sendCapList(conn, to, "LS", ircd.capTokens(conn.capVersion >= 302))
+	case "LIST":
+		enabled := make([]string, 0, len(conn.caps))
+		for name := range conn.caps {
+			enabled = append(enabled, name)
+		}
+		sort.Strings(enabled)
+		ircd.sendCapList(conn, to, "LIST", enabled)
+	case "REQ":
+		requested := strings.Fields(msg.Arg)
+		if len(requested) == 0 {
+			conn.Send(&IrcCapMessage{To: to, Subcommand: "NAK", Caps: requested})
+			return
+		}
+		// The request is applied atomically: one unknown capability rejects
+		// all of them.
+		for _, req := range requested {
+			name := strings.TrimPrefix(req, "-")
+			_, offered := ircd.caps[name]
+			if !offered || (req == "-cap-notify" && conn.capVersion >= 302) {
+				conn.Send(&IrcCapMessage{To: to, Subcommand: "NAK", Caps: requested})
+				return
+			}
+		}
+		for _, req := range requested {
+			if strings.HasPrefix(req, "-") {
+				delete(conn.caps, req[1:])
+			} else {
+				conn.caps[req] = true
+			}
+		}
+		conn.Send(&IrcCapMessage{To: to, Subcommand: "ACK", Caps: requested})
+	case "END":
+		break
+	default:
+		conn.Send(&IrcInvalidCapCommand{to, msg.Subcommand})
+	}
+}
+
+// AdvertiseCap starts offering a capability at runtime and announces it to
+// clients that negotiated cap-notify.
+func (ircd *Ircd) AdvertiseCap(name, value string) {
+	ircd.caps[name] = value
+	ircd.notifyCap(func(conn *IrcConnection, to string) {
+		token := name
+		if conn.capVersion >= 302 && value != "" {
+			token = name + "=" + value
+		}
+		conn.Send(&IrcCapMessage{To: to, Subcommand: "NEW", Caps: []string{token}})
+	})
+}
+
+// WithdrawCap stops offering a capability at runtime, disables it on every
+// connection and announces the removal to clients that negotiated cap-notify.
+func (ircd *Ircd) WithdrawCap(name string) {
+	if _, offered := ircd.caps[name]; !offered {
+		return
+	}
+	delete(ircd.caps, name)
+	ircd.notifyCap(func(conn *IrcConnection, to string) {
+		conn.Send(&IrcCapMessage{To: to, Subcommand: "DEL", Caps: []string{name}})
+	})
+	for conn := range ircd.clientByConn {
+		delete(conn.caps, name)
+	}
+	for conn := range ircd.pending {
+		delete(conn.caps, name)
+	}
+}
+
+func (ircd *Ircd) notifyCap(fn func(conn *IrcConnection, to string)) {
+	for conn, client := range ircd.clientByConn {
+		if conn.caps.Has("cap-notify") {
+			fn(conn, client.Nick)
+		}
+	}
+	for conn, pc := range ircd.pending {
+		if conn.caps.Has("cap-notify") {
+			fn(conn, pc.Target())
+		}
+	}
+}
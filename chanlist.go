@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"strings"
+)
+
+// MaxListEntries caps each of a channel's mask lists, and is advertised via
+// MAXLIST.
+const MaxListEntries = 100
+
+// channelList describes one of a channel's mask list modes and the numerics
+// used to show it.
+type channelList struct {
+	entries    func(channel *lib.Channel) []lib.ListEntry
+	numeric    string
+	endNumeric string
+	endText    string
+	// showMode is set for numerics that repeat the mode letter, which is
+	// only the case for the quiet list.
+	showMode bool
+}
+
+var channelLists = map[byte]channelList{
+	'b': {
+		entries:    func(channel *lib.Channel) []lib.ListEntry { return channel.Ban },
+		numeric:    "367",
+		endNumeric: "368",
+		endText:    "End of Channel Ban List",
+	},
+	'e': {
+		entries:    func(channel *lib.Channel) []lib.ListEntry { return channel.BanExcept },
+		numeric:    "348",
+		endNumeric: "349",
+		endText:    "End of Channel Exception List",
+	},
+	'I': {
+		entries:    func(channel *lib.Channel) []lib.ListEntry { return channel.InviteExcept },
+		numeric:    "346",
+		endNumeric: "347",
+		endText:    "End of Channel Invite List",
+	},
+	// +q is taken by channel owners, so quiets live under +Q.
+	'Q': {
+		entries:    func(channel *lib.Channel) []lib.ListEntry { return channel.Quiet },
+		numeric:    "728",
+		endNumeric: "729",
+		endText:    "End of Channel Quiet List",
+		showMode:   true,
+	},
+}
+
+// IsListQuery reports whether a mode string with no arguments asks for the
+// contents of one or more list modes, as in "MODE #chan +b".
+func IsListQuery(mode string) bool {
+	letters := strings.TrimLeft(mode, "+")
+	if letters == "" {
+		return false
+	}
+	for i := 0; i < len(letters); i++ {
+		if _, found := channelLists[letters[i]]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SendChannelLists sends the contents of each list mode named in mode.
+func (ircd *Ircd) SendChannelLists(conn *IrcConnection, client *lib.Client, channel *lib.Channel, mode string) {
+	chanName := fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
+	letters := strings.TrimLeft(mode, "+")
+	for i := 0; i < len(letters); i++ {
+		list := channelLists[letters[i]]
+		modeLetter := ""
+		if list.showMode {
+			modeLetter = letters[i : i+1]
+		}
+		for _, entry := range list.entries(channel) {
+			conn.Send(&IrcChannelListEntry{
+				Numeric: list.numeric,
+				To:      client.Nick,
+				Channel: chanName,
+				Mode:    modeLetter,
+				Mask:    entry.Mask,
+				SetBy:   entry.SetBy,
+				SetAt:   uint64(entry.SetAt.Unix()),
+			})
+		}
+		conn.Send(&IrcEndOfChannelList{
+			Numeric: list.endNumeric,
+			To:      client.Nick,
+			Channel: chanName,
+			Mode:    modeLetter,
+			Text:    list.endText,
+		})
+	}
+}
+
+// CheckListLimits walks a mode change and reports the first list mode that
+// would grow past MaxListEntries, if any.
+func CheckListLimits(channel *lib.Channel, mode string, args []string) (byte, bool) {
+	paramModes := ChannelListModes + ChannelParamModes + ChannelMemberModes
+	adding := true
+	added := make(map[byte]int)
+	arg := 0
+	for i := 0; i < len(mode); i++ {
+		letter := mode[i]
+		switch {
+		case letter == '+':
+			adding = true
+		case letter == '-':
+			adding = false
+		case strings.IndexByte(paramModes, letter) >= 0 || (adding && strings.IndexByte(ChannelSetParamModes, letter) >= 0):
+			if arg >= len(args) {
+				continue
+			}
+			arg++
+			if list, found := channelLists[letter]; found && adding {
+				added[letter]++
+				if len(list.entries(channel))+added[letter] > MaxListEntries {
+					return letter, false
+				}
+			}
+		}
+	}
+	return 0, true
+}
+
+// IsBanned reports whether client matches the channel's bans without
+// matching an exception.
+func (ircd *Ircd) IsBanned(client *lib.Client, channel *lib.Channel) bool {
+	return ircd.MatchesAnyMask(client, channel.Subnet, channel.Ban) && !ircd.MatchesAnyMask(client, channel.Subnet, channel.BanExcept)
+}
+
+// IsQuieted reports whether client matches the channel's quiets without
+// matching a ban exception.
+func (ircd *Ircd) IsQuieted(client *lib.Client, channel *lib.Channel) bool {
+	return ircd.MatchesAnyMask(client, channel.Subnet, channel.Quiet) && !ircd.MatchesAnyMask(client, channel.Subnet, channel.BanExcept)
+}
@@ -3,8 +3,38 @@ package main
 import (
 	"fmt"
 	"github.com/gossamer-irc/lib"
+	"strconv"
 )
 
+// Channel membership ranks, from lowest to highest.
+const (
+	RankNone = iota
+	RankVoice
+	RankHalfop
+	RankOp
+	RankAdmin
+	RankOwner
+)
+
+// MembershipRank returns the highest rank held by a channel member.
+func MembershipRank(membership *lib.Membership) int {
+	switch {
+	case membership == nil:
+		return RankNone
+	case membership.IsOwner:
+		return RankOwner
+	case membership.IsAdmin:
+		return RankAdmin
+	case membership.IsOp:
+		return RankOp
+	case membership.IsHalfop:
+		return RankHalfop
+	case membership.IsVoice:
+		return RankVoice
+	}
+	return RankNone
+}
+
 type MemberForEachFn func(conn *IrcConnection, member *lib.Client, membership *lib.Membership)
 
 func (ircd *Ircd) ForEachLocalMember(channel *lib.Channel, fn MemberForEachFn) {
@@ -18,6 +48,72 @@ func (ircd *Ircd) ForEachLocalMember(channel *lib.Channel, fn MemberForEachFn) {
 	}
 }
 
+type PeerForEachFn func(conn *IrcConnection, peer *lib.Client)
+
+// ForEachLocalPeer calls fn once for every local client that shares at least
+// one channel with client, not including client itself.
+func (ircd *Ircd) ForEachLocalPeer(client *lib.Client, fn PeerForEachFn) {
+	seen := make(map[*lib.Client]bool)
+	for _, subnet := range ircd.node.Subnet {
+		for _, channel := range subnet.Channel {
+			if _, member := channel.Member[client]; !member {
+				continue
+			}
+			for peer := range channel.LocalMember {
+				if peer == client || seen[peer] {
+					continue
+				}
+				seen[peer] = true
+				conn, found := ircd.connByClient[peer]
+				if !found {
+					continue
+				}
+				fn(conn, peer)
+			}
+		}
+	}
+}
+
+// ChannelsOf returns every channel client is a member of, on any subnet. The
+// map belongs to lib and must not be modified.
+func (ircd *Ircd) ChannelsOf(client *lib.Client) map[*lib.Channel]*lib.Membership {
+	return client.Member
+}
+
+// MembershipPrefix returns the NAMES prefix for a member's highest rank.
+func MembershipPrefix(membership *lib.Membership) string {
+	rank := MembershipRank(membership)
+	if rank == RankNone {
+		return ""
+	}
+	return ChannelMemberPrefixes[RankOwner-rank : RankOwner-rank+1]
+}
+
+// MembershipPrefixes returns the prefixes for every rank a member holds,
+// highest first, as sent to clients that negotiated multi-prefix.
+func MembershipPrefixes(membership *lib.Membership) string {
+	if membership == nil {
+		return ""
+	}
+	prefixes := ""
+	held := []bool{membership.IsOwner, membership.IsAdmin, membership.IsOp, membership.IsHalfop, membership.IsVoice}
+	for i, isHeld := range held {
+		if isHeld {
+			prefixes += ChannelMemberPrefixes[i : i+1]
+		}
+	}
+	return prefixes
+}
+
+// PrefixFor returns the membership prefix to show a connection, which is
+// every held rank with multi-prefix and only the highest one otherwise.
+func PrefixFor(conn *IrcConnection, membership *lib.Membership) string {
+	if conn.caps.Has("multi-prefix") {
+		return MembershipPrefixes(membership)
+	}
+	return MembershipPrefix(membership)
+}
+
 func (ircd *Ircd) SendTopic(conn *IrcConnection, client *lib.Client, channel *lib.Channel) {
 	chanName := fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
 	conn.Send(IrcTopicNumericMessage{
@@ -35,42 +131,130 @@ func (ircd *Ircd) SendTopic(conn *IrcConnection, client *lib.Client, channel *li
 
 func (ircd *Ircd) SendNames(conn *IrcConnection, client *lib.Client, channel *lib.Channel) {
 	chanName := fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
-	name := make([]IrcChannelNameEntry, 0, 15)
-	tlen := 0
+	symbol := "="
+	if channel.Mode.Secret {
+		symbol = "@"
+	} else if channel.Mode.Private {
+		symbol = "*"
+	}
+	reply := IrcChannelNamesReply{
+		To:      client.Nick,
+		Symbol:  symbol,
+		Channel: chanName,
+	}
+	_, shared := channel.Member[client]
 	for member, membership := range channel.Member {
-		prefix := ""
-		if membership.IsOwner {
-			prefix = "~"
-		} else if membership.IsAdmin {
-			prefix = "&"
-		} else if membership.IsOp {
-			prefix = "@"
-		} else if membership.IsHalfop {
-			prefix = "%"
-		} else if membership.IsVoice {
-			prefix = "+"
+		if !shared && !ircd.VisibleTo(member, client) {
+			continue
 		}
 		entry := IrcChannelNameEntry{
-			Nick:   ircd.ClientAsSeenBy(member, client).Nick,
-			Prefix: prefix,
+			Prefix: MembershipPrefixes(membership),
+			NIH:    ircd.ClientAsSeenBy(member, client),
 		}
-		name = append(name, entry)
-		tlen += len(entry.Nick)
-		if tlen > 300 {
-			tlen = 0
-			conn.Send(IrcChannelNamesReply{
-				To:      client.Nick,
-				Channel: chanName,
-				Name:    name,
-			})
-			name = name[:0]
+		next := reply
+		next.Name = append(reply.Name, entry)
+		if len(reply.Name) > 0 && len(next.ToIrcFor(ircd, conn.caps)) > MaxIrcLineLen {
+			conn.Send(&reply)
+			next.Name = []IrcChannelNameEntry{entry}
 		}
+		reply = next
+	}
+	if len(reply.Name) > 0 {
+		conn.Send(&reply)
+	}
+	conn.Send(&IrcEndOfNames{client.Nick, chanName})
+}
+
+// CheckJoin applies an existing channel's modes to a client trying to join
+// it with the given key, returning the error to send if the join must be
+// refused.
+func (ircd *Ircd) CheckJoin(client *lib.Client, channel *lib.Channel, key string) IrcMessage {
+	chanName := fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
+	if channel.Mode.Key != "" && key != channel.Mode.Key {
+		return &IrcBadChannelKey{client.Nick, chanName}
+	}
+	// The limit applies to the channel's members across the whole network.
+	if channel.Mode.Limit > 0 && uint(len(channel.Member)) >= channel.Mode.Limit {
+		return &IrcChannelIsFull{client.Nick, chanName}
+	}
+	if channel.Mode.InviteOnly && !channel.Invited[client] && !ircd.MatchesAnyMask(client, channel.Subnet, channel.InviteExcept) {
+		return &IrcInviteOnlyChan{client.Nick, chanName}
+	}
+	// An invite lets a banned client in, as it does for +i.
+	if ircd.IsBanned(client, channel) && !channel.Invited[client] {
+		return &IrcBannedFromChan{client.Nick, chanName}
+	}
+	return nil
+}
+
+// CheckChannelMessage decides whether client may send to channel, returning
+// the error to send if not. It runs on the sender's server so that refused
+// messages never reach the network.
+func (ircd *Ircd) CheckChannelMessage(client *lib.Client, channel *lib.Channel) IrcMessage {
+	chanName := fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
+	membership, member := channel.Member[client]
+	if channel.Mode.NoExternal && !member {
+		return &IrcCannotSendToChan{client.Nick, chanName, "Cannot send to channel (+n, no external messages)"}
+	}
+	if MembershipRank(membership) >= RankVoice {
+		return nil
 	}
-	if len(name) > 0 {
-		conn.Send(IrcChannelNamesReply{
-			To:      client.Nick,
-			Channel: chanName,
-			Name:    name,
-		})
+	if channel.Mode.Moderated {
+		return &IrcCannotSendToChan{client.Nick, chanName, "Cannot send to channel (+m, moderated)"}
+	}
+	if ircd.IsBanned(client, channel) {
+		return &IrcCannotSendToChan{client.Nick, chanName, "Cannot send to channel (+b, you are banned)"}
+	}
+	if ircd.IsQuieted(client, channel) {
+		return &IrcCannotSendToChan{client.Nick, chanName, "Cannot send to channel (+Q, you are quieted)"}
+	}
+	return nil
+}
+
+// ChannelModeString renders a channel's current modes and their parameters,
+// as used in RPL_CHANNELMODEIS. The key is only revealed if showKey is set.
+func ChannelModeString(channel *lib.Channel, showKey bool) (string, []string) {
+	mode := channel.Mode
+	modes := "+"
+	args := make([]string, 0, 2)
+	flags := []struct {
+		letter byte
+		set    bool
+	}{
+		{'i', mode.InviteOnly},
+		{'m', mode.Moderated},
+		{'n', mode.NoExternal},
+		{'p', mode.Private},
+		{'s', mode.Secret},
+		{'t', mode.TopicLock},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			modes += string(flag.letter)
+		}
+	}
+	if mode.Key != "" {
+		modes += "k"
+		if showKey {
+			args = append(args, mode.Key)
+		} else {
+			args = append(args, "*")
+		}
+	}
+	if mode.Limit > 0 {
+		modes += "l"
+		args = append(args, strconv.FormatUint(uint64(mode.Limit), 10))
+	}
+	return modes, args
+}
+
+// ChannelVisibleTo reports whether a channel may be shown to client in
+// replies such as NAMES and LIST. Secret and private channels are only
+// visible to their members.
+func ChannelVisibleTo(channel *lib.Channel, client *lib.Client) bool {
+	if !channel.Mode.Secret && !channel.Mode.Private {
+		return true
 	}
+	_, member := channel.Member[client]
+	return member
 }
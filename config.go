@@ -0,0 +1,450 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/gossamer-irc/lib"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the daemon's configuration file, written in TOML:
+//
+//	network = "example"
+//	accounts_file = "accounts.txt"
+//	cloak_key = "..."  # the same long random string on every server
+//
+//	[server]
+//	name = "irc1.example.net"
+//	description = "First server"
+//	default_subnet = "main"
+//
+//	[tls]
+//	ca = "ca.pem"
+//	certificate = "irc1.pem"
+//	private_key = "irc1.key"
+//
+//	[[listen]]
+//	address = "0.0.0.0:6697"
+//	type = "client"  # or "server"
+//	tls = true
+//
+//	[[link]]
+//	name = "irc2.example.net"
+//	host = "10.0.0.2"
+//	port = 7000
+//
+//	[[class]]
+//	name = "admin"
+//	privileges = ["connect", "squit", "kill", "kline", "rehash", "die"]
+//
+//	[[oper]]
+//	name = "alice"
+//	password_hash = "$2a$10$..."  # bcrypt, or argon2 in PHC format
+//	host = "*@*"
+//	class = "admin"
+//	fingerprint = "..."  # optional
+//
+//	[limits]
+//	ping_interval = "90s"
+//	registration_timeout = "30s"
+//
+//	[motd]
+//	file = "motd.txt"
+//
+// Server identity can't be changed by a rehash; everything else can.
+type Config struct {
+	Network      string         `toml:"network"`
+	AccountsFile string         `toml:"accounts_file"`
+	CloakKey     string         `toml:"cloak_key"`
+	Server       ServerConfig   `toml:"server"`
+	Tls          TlsConfig      `toml:"tls"`
+	Listen       []ListenConfig `toml:"listen"`
+	Link         []LinkConfig   `toml:"link"`
+	Class        []ClassConfig  `toml:"class"`
+	Oper         []OperConfig   `toml:"oper"`
+	Limits       LimitsConfig   `toml:"limits"`
+	Motd         MotdConfig     `toml:"motd"`
+}
+
+type ServerConfig struct {
+	Name          string `toml:"name"`
+	Description   string `toml:"description"`
+	DefaultSubnet string `toml:"default_subnet"`
+}
+
+type TlsConfig struct {
+	Ca          string `toml:"ca"`
+	Certificate string `toml:"certificate"`
+	PrivateKey  string `toml:"private_key"`
+}
+
+// ListenConfig is a port to accept client or server connections on. Server
+// connections always use TLS.
+type ListenConfig struct {
+	Address string `toml:"address"`
+	Type    string `toml:"type"`
+	Tls     bool   `toml:"tls"`
+}
+
+// LinkConfig names a server that an operator can CONNECT to by name.
+type LinkConfig struct {
+	Name string `toml:"name"`
+	Host string `toml:"host"`
+	Port uint16 `toml:"port"`
+}
+
+type ClassConfig struct {
+	Name       string   `toml:"name"`
+	Privileges []string `toml:"privileges"`
+}
+
+type OperConfig struct {
+	Name         string `toml:"name"`
+	PasswordHash string `toml:"password_hash"`
+	Host         string `toml:"host"`
+	Class        string `toml:"class"`
+	Fingerprint  string `toml:"fingerprint"`
+}
+
+type LimitsConfig struct {
+	PingInterval        string `toml:"ping_interval"`
+	RegistrationTimeout string `toml:"registration_timeout"`
+}
+
+type MotdConfig struct {
+	File string `toml:"file"`
+}
+
+// MinCloakKeyLen is the shortest cloak_key accepted.
+const MinCloakKeyLen = 16
+
+// LoadedConfig is a Config that has been validated, with its files read and
+// its values parsed, ready to be applied by Ircd.ApplyConfig.
+type LoadedConfig struct {
+	*Config
+
+	Listeners           map[string]ListenConfig
+	Links               map[string]LinkConfig
+	Opers               map[string]*OperBlock
+	PingInterval        time.Duration
+	RegistrationTimeout time.Duration
+	Motd                []string
+	Accounts            AccountStore
+}
+
+// LoadConfig reads and validates a configuration file. Every problem found
+// is reported in the returned error, one per line.
+func LoadConfig(path string) (*LoadedConfig, error) {
+	config := &Config{
+		Limits: LimitsConfig{
+			PingInterval:        "90s",
+			RegistrationTimeout: "30s",
+		},
+	}
+	meta, err := toml.DecodeFile(path, config)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, key := range meta.Undecoded() {
+		problems = append(problems, fmt.Sprintf("unknown setting %s", key))
+	}
+	loaded, more := config.validate()
+	problems = append(problems, more...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s:\n%s", path, strings.Join(problems, "\n"))
+	}
+	return loaded, nil
+}
+
+func (config *Config) validate() (loaded *LoadedConfig, problems []string) {
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	loaded = &LoadedConfig{
+		Config:    config,
+		Listeners: make(map[string]ListenConfig),
+		Links:     make(map[string]LinkConfig),
+		Opers:     make(map[string]*OperBlock),
+	}
+
+	if config.Network == "" {
+		problem("must specify network")
+	}
+	if config.Server.Name == "" {
+		problem("must specify server.name")
+	}
+	if config.Server.DefaultSubnet == "" {
+		problem("must specify server.default_subnet")
+	}
+	if len(config.CloakKey) < MinCloakKeyLen {
+		problem("cloak_key must be at least %d characters", MinCloakKeyLen)
+	}
+	if config.Server.Description == "" {
+		log.Printf("server.description not specified, description will be empty")
+	}
+
+	if config.Tls.Ca == "" {
+		problem("must specify tls.ca")
+	}
+	if config.Tls.Certificate == "" {
+		problem("must specify tls.certificate")
+	}
+	if config.Tls.PrivateKey == "" {
+		problem("must specify tls.private_key")
+	}
+
+	for _, listen := range config.Listen {
+		host, port, err := net.SplitHostPort(listen.Address)
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil {
+			problem("invalid listen address %s: %s", listen.Address, err)
+			continue
+		}
+		switch listen.Type {
+		case "client":
+		case "server":
+			// Links are always TLS.
+			listen.Tls = true
+		default:
+			problem("listen %s: type must be client or server", listen.Address)
+			continue
+		}
+		listen.Address = net.JoinHostPort(host, port)
+		if _, dup := loaded.Listeners[listen.Address]; dup {
+			problem("listen %s: address used more than once", listen.Address)
+			continue
+		}
+		loaded.Listeners[listen.Address] = listen
+	}
+
+	for _, link := range config.Link {
+		if link.Name == "" || link.Host == "" || link.Port == 0 {
+			problem("link blocks need a name, host and port")
+			continue
+		}
+		name := strings.ToLower(link.Name)
+		if _, dup := loaded.Links[name]; dup {
+			problem("link %s: name used more than once", link.Name)
+			continue
+		}
+		loaded.Links[name] = link
+	}
+
+	classes := make(map[string]*OperClass)
+	for _, class := range config.Class {
+		if _, dup := classes[class.Name]; dup {
+			problem("class %s: name used more than once", class.Name)
+			continue
+		}
+		operClass, err := NewOperClass(class.Name, class.Privileges)
+		if err != nil {
+			problem("%s", err)
+			continue
+		}
+		classes[class.Name] = operClass
+	}
+	for _, oper := range config.Oper {
+		if oper.Name == "" || oper.PasswordHash == "" {
+			problem("oper blocks need a name and password_hash")
+			continue
+		}
+		if _, dup := loaded.Opers[oper.Name]; dup {
+			problem("oper %s: name used more than once", oper.Name)
+			continue
+		}
+		class, found := classes[oper.Class]
+		if !found {
+			problem("oper %s: undefined class %q", oper.Name, oper.Class)
+			continue
+		}
+		host := oper.Host
+		if host == "" {
+			host = "*@*"
+		}
+		loaded.Opers[oper.Name] = &OperBlock{
+			Name:         oper.Name,
+			PasswordHash: oper.PasswordHash,
+			HostMask:     host,
+			Fingerprint:  normalizeFingerprint(oper.Fingerprint),
+			Class:        class,
+		}
+	}
+
+	var err error
+	if loaded.PingInterval, err = time.ParseDuration(config.Limits.PingInterval); err != nil {
+		problem("limits.ping_interval: %s", err)
+	}
+	if loaded.RegistrationTimeout, err = time.ParseDuration(config.Limits.RegistrationTimeout); err != nil {
+		problem("limits.registration_timeout: %s", err)
+	}
+
+	if config.Motd.File != "" {
+		motd, err := ioutil.ReadFile(config.Motd.File)
+		if err != nil {
+			problem("motd.file: %s", err)
+		} else {
+			loaded.Motd = strings.Split(strings.TrimRight(strings.Replace(string(motd), "\r\n", "\n", -1), "\n"), "\n")
+		}
+	}
+
+	if config.AccountsFile != "" {
+		accounts, err := LoadFileAccountStore(config.AccountsFile)
+		if err != nil {
+			problem("accounts_file: %s", err)
+		} else {
+			loaded.Accounts = accounts
+		}
+	}
+	return
+}
+
+// activeListener is an open listener and the configuration it was opened with.
+type activeListener struct {
+	ListenConfig
+	io.Closer
+}
+
+// ErrIdentityChanged is reported by a rehash that tried to change the server
+// identity, which is left as it was.
+var ErrIdentityChanged = errors.New("network, server name, description and default subnet can't change without a restart")
+
+// ErrCloakKeyChanged is reported by a rehash that tried to change the cloak
+// key, which is left as it was: a new key would change every cloaked host on
+// the network at once.
+var ErrCloakKeyChanged = errors.New("cloak_key can't change without a restart")
+
+// ApplyConfig puts a loaded configuration into effect. The first
+// configuration applied also opens every listener; later ones open new
+// listeners, reopen changed ones and close removed ones. A changed listener
+// that can't be reopened keeps its old settings. Nothing is changed if the
+// TLS material fails to load.
+func (ircd *Ircd) ApplyConfig(config *LoadedConfig) error {
+	if err := ircd.LoadTls(config.Tls.Ca, config.Tls.Certificate, config.Tls.PrivateKey); err != nil {
+		return err
+	}
+	ircd.SetTimeouts(config.PingInterval, config.RegistrationTimeout)
+	ircd.SetOpers(config.Opers)
+	ircd.SetAccountStore(config.Accounts)
+	ircd.links = config.Links
+	ircd.motd = config.Motd
+
+	var errs []string
+	for address, listener := range ircd.listeners {
+		if _, keep := config.Listeners[address]; !keep {
+			log.Printf("Closing listener on %s", address)
+			listener.Close()
+			delete(ircd.listeners, address)
+		}
+	}
+	for address, listen := range config.Listeners {
+		old, open := ircd.listeners[address]
+		if open && old.ListenConfig == listen {
+			continue
+		}
+		if open {
+			// The address can only be bound once, so the old listener has
+			// to go first. It's put back if the new one can't be opened.
+			old.Close()
+			delete(ircd.listeners, address)
+		}
+		listener, err := ircd.openListener(listen)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("listen %s: %s", address, err))
+			if !open {
+				continue
+			}
+			if listener, err = ircd.openListener(old.ListenConfig); err != nil {
+				errs = append(errs, fmt.Sprintf("listen %s: reopening with the old settings: %s", address, err))
+				continue
+			}
+			listen = old.ListenConfig
+		}
+		ircd.listeners[address] = activeListener{listen, listener}
+	}
+
+	if ircd.config != nil {
+		old := ircd.config
+		if old.Network != config.Network || old.Server != config.Server {
+			errs = append(errs, ErrIdentityChanged.Error())
+			config.Network = old.Network
+			config.Server = old.Server
+		}
+		if old.CloakKey != config.CloakKey {
+			errs = append(errs, ErrCloakKeyChanged.Error())
+			config.CloakKey = old.CloakKey
+		}
+	}
+	ircd.cloakKey = config.CloakKey
+	ircd.config = config
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// openListener opens a listener for a validated listen block.
+func (ircd *Ircd) openListener(listen ListenConfig) (io.Closer, error) {
+	host, portStr, _ := net.SplitHostPort(listen.Address)
+	port64, _ := strconv.ParseUint(portStr, 10, 16)
+	port := uint16(port64)
+
+	if listen.Type == "server" {
+		log.Printf("Listening for server connections on %s port %d", host, port)
+		return ircd.NewLinkListener(host, port)
+	}
+	tlsStr := ""
+	if listen.Tls {
+		tlsStr = "TLS "
+	}
+	log.Printf("Listening for %sclient connections on %s port %d", tlsStr, host, port)
+	return ircd.NewListener(host, port, listen.Tls)
+}
+
+// Rehash reloads the configuration file the daemon was started with. Errors
+// are logged and sent to operators, and a configuration that fails
+// validation leaves the running one in place.
+func (ircd *Ircd) Rehash() error {
+	log.Printf("Rehashing %s", ircd.configPath)
+	config, err := LoadConfig(ircd.configPath)
+	if err == nil {
+		err = ircd.ApplyConfig(config)
+	}
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			log.Printf("Rehash: %s", line)
+			ircd.SendServerNotice(SnomaskOpers, "Rehash: %s", line)
+		}
+	}
+	return err
+}
+
+// SendMotd sends the message of the day read from motd.file, or 422 if there
+// isn't one. A long MOTD is streamed, so it can't overflow the sendQ of a
+// client that has just registered.
+func (ircd *Ircd) SendMotd(conn *IrcConnection, client *lib.Client) {
+	if len(ircd.motd) == 0 {
+		conn.Send(&IrcNoMotd{client.Nick})
+		return
+	}
+	if ircd.streams[conn] != nil {
+		conn.Send(&IrcTryAgain{client.Nick, "MOTD"})
+		return
+	}
+	replies := make([]IrcMessage, 0, len(ircd.motd)+2)
+	replies = append(replies, &IrcMotdStart{client.Nick})
+	for _, line := range ircd.motd {
+		replies = append(replies, &IrcMotdLine{client.Nick, line})
+	}
+	replies = append(replies, &IrcEndOfMotd{client.Nick})
+	ircd.SendStream(conn, replies)
+}
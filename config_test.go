@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a Config that passes validation.
+func validConfig() *Config {
+	return &Config{
+		Network:  "example",
+		CloakKey: "0123456789abcdef",
+		Server: ServerConfig{
+			Name:          "irc1.example.net",
+			Description:   "First server",
+			DefaultSubnet: "main",
+		},
+		Tls: TlsConfig{
+			Ca:          "ca.pem",
+			Certificate: "irc1.pem",
+			PrivateKey:  "irc1.key",
+		},
+		Listen: []ListenConfig{
+			{Address: "0.0.0.0:6697", Type: "client", Tls: true},
+			{Address: "0.0.0.0:7000", Type: "server"},
+		},
+		Link:  []LinkConfig{{Name: "irc2.example.net", Host: "10.0.0.2", Port: 7000}},
+		Class: []ClassConfig{{Name: "admin", Privileges: []string{"connect", "rehash"}}},
+		Oper:  []OperConfig{{Name: "alice", PasswordHash: "$2a$10$x", Class: "admin"}},
+		Limits: LimitsConfig{
+			PingInterval:        "90s",
+			RegistrationTimeout: "30s",
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(config *Config)
+		problem string
+	}{
+		{"valid", func(config *Config) {}, ""},
+		{"no network", func(config *Config) { config.Network = "" }, "must specify network"},
+		{"no server name", func(config *Config) { config.Server.Name = "" }, "server.name"},
+		{"no default subnet", func(config *Config) { config.Server.DefaultSubnet = "" }, "server.default_subnet"},
+		{"no ca", func(config *Config) { config.Tls.Ca = "" }, "tls.ca"},
+		{"short cloak key", func(config *Config) { config.CloakKey = "short" }, "cloak_key"},
+		{"bad listen address", func(config *Config) { config.Listen[0].Address = "6697" }, "invalid listen address"},
+		{"bad listen port", func(config *Config) { config.Listen[0].Address = "0.0.0.0:70000" }, "invalid listen address"},
+		{"bad listen type", func(config *Config) { config.Listen[0].Type = "both" }, "type must be client or server"},
+		{"duplicate listen", func(config *Config) { config.Listen[1].Address = "0.0.0.0:6697" }, "used more than once"},
+		{"incomplete link", func(config *Config) { config.Link[0].Port = 0 }, "link blocks need"},
+		{"duplicate link", func(config *Config) {
+			config.Link = append(config.Link, LinkConfig{Name: "IRC2.example.net", Host: "10.0.0.3", Port: 7000})
+		}, "link IRC2.example.net: name used more than once"},
+		{"unknown privilege", func(config *Config) {
+			config.Class[0].Privileges = []string{"fly"}
+			config.Oper = nil
+		}, "unknown privilege"},
+		{"duplicate class", func(config *Config) { config.Class = append(config.Class, config.Class[0]) }, "class admin: name used more than once"},
+		{"oper without hash", func(config *Config) { config.Oper[0].PasswordHash = "" }, "password_hash"},
+		{"duplicate oper", func(config *Config) { config.Oper = append(config.Oper, config.Oper[0]) }, "oper alice: name used more than once"},
+		{"undefined class", func(config *Config) { config.Oper[0].Class = "nobody" }, "undefined class"},
+		{"bad ping interval", func(config *Config) { config.Limits.PingInterval = "soon" }, "limits.ping_interval"},
+		{"missing motd", func(config *Config) { config.Motd.File = filepath.Join(t.TempDir(), "missing") }, "motd.file"},
+		{"missing accounts", func(config *Config) { config.AccountsFile = filepath.Join(t.TempDir(), "missing") }, "accounts_file"},
+	}
+	for _, test := range tests {
+		config := validConfig()
+		test.change(config)
+		_, problems := config.validate()
+		if test.problem == "" {
+			if len(problems) > 0 {
+				t.Errorf("%s: unexpected problems %q", test.name, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0], test.problem) {
+			t.Errorf("%s: got problems %q, want one mentioning %q", test.name, problems, test.problem)
+		}
+	}
+}
+
+func TestValidateResults(t *testing.T) {
+	config := validConfig()
+	config.Listen[1].Address = "[::]:7000"
+	loaded, problems := config.validate()
+	if len(problems) > 0 {
+		t.Fatalf("unexpected problems %q", problems)
+	}
+	if listen := loaded.Listeners["[::]:7000"]; !listen.Tls {
+		t.Errorf("server listener not forced to TLS: %+v", listen)
+	}
+	if _, found := loaded.Links["irc2.example.net"]; !found {
+		t.Errorf("link not loaded: %v", loaded.Links)
+	}
+	oper := loaded.Opers["alice"]
+	if oper == nil || oper.HostMask != "*@*" || !oper.Can(PrivRehash) || oper.Can(PrivDie) {
+		t.Errorf("oper not loaded as expected: %+v", oper)
+	}
+	if loaded.PingInterval != 90*time.Second || loaded.RegistrationTimeout != 30*time.Second {
+		t.Errorf("limits = %s, %s", loaded.PingInterval, loaded.RegistrationTimeout)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	motd := filepath.Join(dir, "motd.txt")
+	if err := os.WriteFile(motd, []byte("Welcome\r\n\r\nBe nice\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	base := `
+network = "example"
+cloak_key = "0123456789abcdef"
+
+[server]
+name = "irc1.example.net"
+description = "First server"
+default_subnet = "main"
+
+[tls]
+ca = "ca.pem"
+certificate = "irc1.pem"
+private_key = "irc1.key"
+
+[[listen]]
+address = "0.0.0.0:6667"
+type = "client"
+
+[[class]]
+name = "admin"
+privileges = ["connect", "rehash"]
+
+[[oper]]
+name = "alice"
+password_hash = "$2a$10$x"
+class = "admin"
+
+[motd]
+file = "` + filepath.ToSlash(motd) + `"
+`
+	tests := []struct {
+		name  string
+		extra string
+		err   string
+	}{
+		{"valid", "", ""},
+		{"limits", "\n[limits]\nping_interval = \"2m\"\n", ""},
+		{"unknown setting", "\n[limits]\nping = \"2m\"\n", "unknown setting limits.ping"},
+		{"old password key", "\n[[oper]]\nname = \"bob\"\npassword = \"x\"\nclass = \"admin\"\n", "unknown setting oper.password"},
+		{"syntax error", "\n[server\n", "toml"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "gossamer.toml")
+		if err := os.WriteFile(path, []byte(base+test.extra), 0600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadConfig(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want one mentioning %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if want := []string{"Welcome", "", "Be nice"}; strings.Join(loaded.Motd, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: motd = %q, want %q", test.name, loaded.Motd, want)
+		}
+	}
+}
+
+func TestMotdLineLength(t *testing.T) {
+	ircd := testIrcd()
+	line := IrcMotdLine{"nick", strings.Repeat("é", MaxIrcLineLen)}.ToIrc(ircd)
+	if len(line) > MaxIrcLineLen {
+		t.Errorf("MOTD line is %d bytes", len(line))
+	}
+	if short := (IrcMotdLine{"nick", "hello"}).ToIrc(ircd); !strings.HasSuffix(short, ":- hello") {
+		t.Errorf("short MOTD line changed: %q", short)
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/gossamer-irc/daemon
+
+go 1.25.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/gossamer-irc/lib v0.0.0
+	golang.org/x/crypto v0.54.0
+)
+
+require golang.org/x/sys v0.47.0 // indirect
@@ -2,38 +2,133 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/gossamer-irc/lib"
 	"io"
-	"log"
 	"sync"
+	"time"
 )
 
+var ErrRegistrationTimeout = errors.New("Registration timed out")
+
+// SendQSize is the number of bytes that may be queued for a client before
+// the connection is considered stalled.
+// TODO: configurable buffer size
+const SendQSize = 2048
+
+// CloseFlushTimeout bounds how long a closing connection waits for its sendQ
+// to drain before the socket is closed anyway.
+const CloseFlushTimeout = 5 * time.Second
+
 type IrcConnectionEvent struct {
 	Connection *IrcConnection
 	Message    IrcClientMessage
 	Err        error
 }
 
+// IdleIrcClientMessage is raised by a connection's control loop, rather than
+// read from the client, when the client has been silent for the ping
+// interval. The ircd answers it by sending a PING.
+type IdleIrcClientMessage struct{}
+
+func (msg IdleIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg IdleIrcClientMessage) String() string {
+	return "idle()"
+}
+
+// VerifiedIrcClientMessage carries the result of a password check, which is
+// run on its own goroutine, back to the ircd. Done is called from Run if the
+// connection is still open.
+type VerifiedIrcClientMessage struct {
+	Done func()
+}
+
+func (msg VerifiedIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg VerifiedIrcClientMessage) String() string {
+	return "verified()"
+}
+
 type IrcConnection struct {
 	ircd     *Ircd
 	client   *lib.Client
 	sendQ    *lib.SendQ
+	sendLock sync.Mutex
 	reader   *bufio.Reader
+	closer   io.Closer
+	tlsConn  *tls.Conn
 	recv     chan<- IrcConnectionEvent
 	trans    chan IrcConnectionEvent
 	exit     chan struct{}
+	exitOnce sync.Once
 	onSuffix bool
+
+	// registered is closed once the connection has a client attached, which
+	// cancels the registration deadline.
+	registered chan struct{}
+
+	// pingInterval and registrationTimeout are copied from the ircd when the
+	// connection is made, since a rehash may change them while the control
+	// loop is running.
+	pingInterval        time.Duration
+	registrationTimeout time.Duration
+
+	// Capabilities negotiated with CAP, and the highest CAP LS version seen.
+	caps       CapSet
+	capVersion int
+
+	// signon is when the connection was accepted, and lastActive when the
+	// client last sent a message to a user or channel.
+	signon     time.Time
+	lastActive time.Time
+
+	// oper is the block the client opered up with, which grants its
+	// privileges while it keeps +o.
+	oper *OperBlock
+
+	// snomask holds the server notice letters for user mode +s.
+	snomask string
+
+	// verifying is set while a password is being checked, and authFailures
+	// counts failed SASL and OPER attempts.
+	verifying    bool
+	authFailures int
+
+	// creatorKeys holds the key given when joining a channel that didn't
+	// exist, by qualified name, until the join arrives through OnChannelJoin.
+	creatorKeys map[string]string
 }
 
 func NewIrcConnection(ircd *Ircd, reader io.Reader, writer io.WriteCloser, recv chan<- IrcConnectionEvent) *IrcConnection {
 	irc := &IrcConnection{
 		ircd:   ircd,
-		reader: bufio.NewReaderSize(reader, 512),
-		// TODO: configurable buffer size
-		sendQ: lib.NewSendQ(writer, 2048, ircd.wg),
-		trans: make(chan IrcConnectionEvent),
-		recv:  recv,
-		exit:  make(chan struct{}),
+		reader: bufio.NewReaderSize(reader, MaxTagsLen+MaxIrcLineLen+2),
+		sendQ:  lib.NewSendQ(writer, SendQSize, ircd.wg),
+		closer: writer,
+		trans:  make(chan IrcConnectionEvent),
+		recv:   recv,
+		exit:   make(chan struct{}),
+
+		registered:          make(chan struct{}),
+		pingInterval:        ircd.pingInterval,
+		registrationTimeout: ircd.registrationTimeout,
+		caps:                make(CapSet),
+		creatorKeys:         make(map[string]string),
+		signon:              time.Now(),
+		lastActive:          time.Now(),
+	}
+	if tlsConn, ok := writer.(*tls.Conn); ok {
+		irc.tlsConn = tlsConn
 	}
 	ircd.wg.Add(2)
 	go irc.controlLoop(ircd.wg)
@@ -42,24 +137,141 @@ func NewIrcConnection(ircd *Ircd, reader io.Reader, writer io.WriteCloser, recv
 }
 
 func (irc *IrcConnection) SetClient(client *lib.Client) {
+	if irc.client == nil {
+		close(irc.registered)
+	}
 	irc.client = client
 }
 
+// PeerCertificate returns the verified certificate the client presented during
+// the TLS handshake, or nil if it presented none or isn't using TLS.
+func (irc *IrcConnection) PeerCertificate() *x509.Certificate {
+	if irc.tlsConn == nil {
+		return nil
+	}
+	state := irc.tlsConn.ConnectionState()
+	if !state.HandshakeComplete || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// Secure reports whether the client is connected over TLS.
+func (irc *IrcConnection) Secure() bool {
+	return irc.tlsConn != nil
+}
+
+// CertificateFingerprint returns the hex SHA-256 fingerprint of a certificate.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Send queues a message for the client. Messages are normally sent from the
+// Ircd.Run goroutine; each line is written whole, so one sent from elsewhere
+// can't split another.
 func (irc *IrcConnection) Send(msg IrcMessage) {
-	irc.sendQ.Write([]byte(msg.ToIrc(irc.ircd)))
-	irc.sendQ.Write([]byte("\r\n"))
+	line := irc.render(msg)
+	irc.sendLock.Lock()
+	defer irc.sendLock.Unlock()
+	irc.sendQ.Write([]byte(line + "\r\n"))
+}
+
+// render encodes a message as it will be sent on this connection, without
+// the trailing CRLF.
+func (irc *IrcConnection) render(msg IrcMessage) string {
+	if capMsg, ok := msg.(IrcCapAwareMessage); ok {
+		return capMsg.ToIrcFor(irc.ircd, irc.caps)
+	}
+	return msg.ToIrc(irc.ircd)
+}
+
+// Close signals both connection goroutines to exit and closes the underlying
+// socket once whatever is in the sendQ has been written, or after
+// CloseFlushTimeout if it can't be. Closing the socket unblocks any pending
+// read. It is safe to call more than once.
+func (irc *IrcConnection) Close() {
+	irc.exitOnce.Do(func() {
+		close(irc.exit)
+		irc.ircd.wg.Add(1)
+		go irc.closeWhenFlushed(irc.ircd.wg)
+	})
+}
+
+func (irc *IrcConnection) closeWhenFlushed(wg *sync.WaitGroup) {
+	defer wg.Done()
+	deadline := time.Now().Add(CloseFlushTimeout)
+	for irc.sendQ.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(StreamPollInterval)
+	}
+	irc.closer.Close()
 }
 
 func (irc *IrcConnection) controlLoop(wg *sync.WaitGroup) {
 	defer wg.Done()
+	trans := irc.trans
+	registered := irc.registered
+
+	// A zero interval disables the corresponding timer, since a nil channel
+	// never becomes ready.
+	var idle, registration *time.Timer
+	var idleC, registrationC <-chan time.Time
+	if irc.pingInterval > 0 {
+		idle = time.NewTimer(irc.pingInterval)
+		defer idle.Stop()
+		idleC = idle.C
+	}
+	if irc.registrationTimeout > 0 {
+		registration = time.NewTimer(irc.registrationTimeout)
+		defer registration.Stop()
+		registrationC = registration.C
+	}
+	awaitingPong := false
+
 	for {
 		select {
-		case event := <-irc.trans:
-			log.Printf("Forwarding event.")
+		case event, ok := <-trans:
+			if !ok {
+				// The read loop is gone; wait for Close() to be called.
+				trans = nil
+				break
+			}
+			// Any traffic from the client proves it's alive.
+			if idle != nil {
+				resetTimer(idle, irc.pingInterval)
+				awaitingPong = false
+			}
 			irc.recv <- event
 			break
+		case <-idleC:
+			if awaitingPong {
+				irc.recv <- IrcConnectionEvent{
+					Connection: irc,
+					Err:        fmt.Errorf("Ping timeout: %d seconds", int(2*irc.pingInterval/time.Second)),
+				}
+				idleC = nil
+				break
+			}
+			// The ircd sends the PING, keeping all writes on its goroutine.
+			irc.recv <- IrcConnectionEvent{
+				Connection: irc,
+				Message:    &IdleIrcClientMessage{},
+			}
+			awaitingPong = true
+			idle.Reset(irc.pingInterval)
+		case <-registered:
+			registered = nil
+			registrationC = nil
+		case <-registrationC:
+			irc.recv <- IrcConnectionEvent{
+				Connection: irc,
+				Err:        ErrRegistrationTimeout,
+			}
+			registrationC = nil
 		case <-irc.exit:
-			for _ = range irc.trans {
+			if trans != nil {
+				for _ = range trans {
+				}
 			}
 			return
 		case sqErr := <-irc.sendQ.ErrChan():
@@ -73,18 +285,26 @@ func (irc *IrcConnection) controlLoop(wg *sync.WaitGroup) {
 	}
 }
 
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
 func (irc *IrcConnection) readLoop(wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer close(irc.trans)
 	for {
 		select {
 		case <-irc.exit:
-			close(irc.trans)
-			irc.trans = nil
 			return
 		default:
 			// Attempt a read.
 			data, isPrefix, err := irc.reader.ReadLine()
-			log.Printf("Read line: %s", string(data))
 			if err != nil {
 				irc.trans <- IrcConnectionEvent{
 					Connection: irc,
@@ -100,15 +320,28 @@ func (irc *IrcConnection) readLoop(wg *sync.WaitGroup) {
 				}
 			} else {
 				if isPrefix {
+					// The line doesn't fit in the buffer, so it can't be within
+					// the limits. Drop it along with its remaining segments.
 					irc.onSuffix = true
+					irc.trans <- IrcConnectionEvent{
+						Connection: irc,
+						Message:    &InputTooLongIrcClientMessage{},
+					}
+					continue
 				}
 				// Process the new line.
 				line := string(data)
+				if !CheckLineLength(line) {
+					irc.trans <- IrcConnectionEvent{
+						Connection: irc,
+						Message:    &InputTooLongIrcClientMessage{},
+					}
+					continue
+				}
 
 				// Parse the line into a GenericIrcClientMessage
 				generic, valid := ParseIrc(line)
 				if !valid {
-					log.Printf("Invalid.")
 					continue
 				}
 				irc.trans <- IrcConnectionEvent{
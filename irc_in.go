@@ -11,34 +11,48 @@ type IrcClientMessage interface {
 }
 
 type GenericIrcClientMessage struct {
+	Tags    IrcTags
 	Command string
 	Args    []string
 }
 
 func ParseIrc(line string) (msg *GenericIrcClientMessage, valid bool) {
-	split := strings.Split(line, " ")
+	var tags IrcTags
+	if strings.HasPrefix(line, "@") {
+		idx := strings.IndexByte(line, ' ')
+		if idx < 0 {
+			return
+		}
+		tags = ParseTags(line[1:idx])
+		line = line[idx+1:]
+	}
+
+	// Everything after the first " :" is a single trailing argument.
+	trailing, hasTrailing := "", false
+	if idx := strings.Index(line, " :"); idx >= 0 {
+		trailing, hasTrailing = line[idx+2:], true
+		line = line[:idx]
+	}
+
+	// Arguments are separated by one or more spaces.
+	split := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ' '
+	})
+	if len(split) > 0 && strings.HasPrefix(split[0], ":") {
+		// Clients may send a source prefix, which is ignored.
+		split = split[1:]
+	}
 	if len(split) == 0 {
 		return
 	}
 	command := strings.ToUpper(split[0])
 	args := split[1:]
-
-	remainingStart := len(args)
-	for idx, arg := range args {
-		if arg[0:1] == ":" {
-			remainingStart = idx
-			args[idx] = args[idx][1:]
-			break
-		}
-	}
-
-	if remainingStart < len(args) {
-		remainder := args[remainingStart:]
-		args = args[0 : remainingStart+1]
-		args[remainingStart] = strings.Join(remainder, " ")
+	if hasTrailing {
+		args = append(args, trailing)
 	}
 
 	msg = &GenericIrcClientMessage{
+		Tags:    tags,
 		Command: command,
 		Args:    args,
 	}
@@ -68,6 +82,57 @@ func (msg InvalidIrcClientMessage) String() string {
 	return fmt.Sprintf("invalid(%s, %d)", msg.Command, msg.MinArgs)
 }
 
+// NoTextIrcClientMessage is a PRIVMSG with a target but nothing to send.
+type NoTextIrcClientMessage struct {
+	Command string
+}
+
+func (msg NoTextIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg NoTextIrcClientMessage) String() string {
+	return fmt.Sprintf("notext(%s)", msg.Command)
+}
+
+// DroppedIrcClientMessage is a malformed message that gets no reply at all.
+// A NOTICE must never cause an automatic reply, even an error.
+type DroppedIrcClientMessage struct {
+	Command string
+}
+
+func (msg DroppedIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg DroppedIrcClientMessage) String() string {
+	return fmt.Sprintf("dropped(%s)", msg.Command)
+}
+
+// InputTooLongIrcClientMessage stands in for a line that exceeded the tag or
+// body length limits and was discarded.
+type InputTooLongIrcClientMessage struct{}
+
+func (msg InputTooLongIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg InputTooLongIrcClientMessage) String() string {
+	return "inputtoolong()"
+}
+
+type UnknownIrcClientMessage struct {
+	Command string
+}
+
+func (msg UnknownIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg UnknownIrcClientMessage) String() string {
+	return fmt.Sprintf("unknown(%s)", msg.Command)
+}
+
 type NickIrcClientMessage struct {
 	Nick string
 }
@@ -95,6 +160,7 @@ func (msg UserIrcClientMessage) String() string {
 type PMIrcClientMessage struct {
 	To      string
 	Message string
+	Tags    IrcTags
 }
 
 func (msg PMIrcClientMessage) isIrcClientMessage() bool {
@@ -108,6 +174,7 @@ func (msg PMIrcClientMessage) String() string {
 type ChannelIrcClientMessage struct {
 	To      string
 	Message string
+	Tags    IrcTags
 }
 
 func (msg ChannelIrcClientMessage) isIrcClientMessage() bool {
@@ -118,6 +185,33 @@ func (msg ChannelIrcClientMessage) String() string {
 	return fmt.Sprintf("chanmsg(%s, %s", msg.To, msg.Message)
 }
 
+type NoticeIrcClientMessage struct {
+	To      string
+	Message string
+	Tags    IrcTags
+}
+
+func (msg NoticeIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg NoticeIrcClientMessage) String() string {
+	return fmt.Sprintf("notice(%s, %s)", msg.To, msg.Message)
+}
+
+type TagMsgIrcClientMessage struct {
+	To   string
+	Tags IrcTags
+}
+
+func (msg TagMsgIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg TagMsgIrcClientMessage) String() string {
+	return fmt.Sprintf("tagmsg(%s, %s)", msg.To, msg.Tags)
+}
+
 type ConnectIrcClientMessage struct {
 	Target string
 	Host   string
@@ -132,6 +226,39 @@ func (msg ConnectIrcClientMessage) String() string {
 	return fmt.Sprintf("connect(%s, %d)", msg.Host, msg.Port)
 }
 
+type RehashIrcClientMessage struct{}
+
+func (msg RehashIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg RehashIrcClientMessage) String() string {
+	return "rehash()"
+}
+
+type MotdIrcClientMessage struct{}
+
+func (msg MotdIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg MotdIrcClientMessage) String() string {
+	return "motd()"
+}
+
+type OperIrcClientMessage struct {
+	Name     string
+	Password string
+}
+
+func (msg OperIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg OperIrcClientMessage) String() string {
+	return fmt.Sprintf("oper(%s)", msg.Name)
+}
+
 type JoinIrcClientMessage struct {
 	Targets []string
 	Keys    []string
@@ -159,10 +286,218 @@ func (msg ChannelModeChangeIrcClientMessage) String() string {
 	return fmt.Sprintf("chmode(%s, %s, [%s])", msg.Target, msg.Mode, strings.Join(msg.Arg, ", "))
 }
 
+// UserModeIrcClientMessage is a MODE aimed at a nickname. An empty Mode is
+// a query.
+type UserModeIrcClientMessage struct {
+	Target string
+	Mode   string
+	Arg    []string
+}
+
+func (msg UserModeIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg UserModeIrcClientMessage) String() string {
+	return fmt.Sprintf("umode(%s, %s, [%s])", msg.Target, msg.Mode, strings.Join(msg.Arg, ", "))
+}
+
+type PartIrcClientMessage struct {
+	Targets []string
+	Reason  string
+}
+
+func (msg PartIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg PartIrcClientMessage) String() string {
+	return fmt.Sprintf("part([%s], %s)", strings.Join(msg.Targets, ", "), msg.Reason)
+}
+
+type TopicIrcClientMessage struct {
+	Target string
+	Topic  string
+	Set    bool
+}
+
+func (msg TopicIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg TopicIrcClientMessage) String() string {
+	return fmt.Sprintf("topic(%s, %v, %s)", msg.Target, msg.Set, msg.Topic)
+}
+
+type CapIrcClientMessage struct {
+	Subcommand string
+	Arg        string
+}
+
+func (msg CapIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg CapIrcClientMessage) String() string {
+	return fmt.Sprintf("cap(%s, %s)", msg.Subcommand, msg.Arg)
+}
+
+type AuthenticateIrcClientMessage struct {
+	Data string
+}
+
+func (msg AuthenticateIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg AuthenticateIrcClientMessage) String() string {
+	return "authenticate(...)"
+}
+
+type WhoisIrcClientMessage struct {
+	Targets []string
+}
+
+func (msg WhoisIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg WhoisIrcClientMessage) String() string {
+	return fmt.Sprintf("whois([%s])", strings.Join(msg.Targets, ", "))
+}
+
+type WhoIrcClientMessage struct {
+	Mask  string
+	Flags string
+}
+
+func (msg WhoIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg WhoIrcClientMessage) String() string {
+	return fmt.Sprintf("who(%s, %s)", msg.Mask, msg.Flags)
+}
+
+type NamesIrcClientMessage struct {
+	Targets []string
+}
+
+func (msg NamesIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg NamesIrcClientMessage) String() string {
+	return fmt.Sprintf("names([%s])", strings.Join(msg.Targets, ", "))
+}
+
+type ChannelModeQueryIrcClientMessage struct {
+	Target string
+}
+
+func (msg ChannelModeQueryIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg ChannelModeQueryIrcClientMessage) String() string {
+	return fmt.Sprintf("chmodequery(%s)", msg.Target)
+}
+
+type KickIrcClientMessage struct {
+	Channel string
+	Targets []string
+	Reason  string
+}
+
+func (msg KickIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg KickIrcClientMessage) String() string {
+	return fmt.Sprintf("kick(%s, [%s], %s)", msg.Channel, strings.Join(msg.Targets, ", "), msg.Reason)
+}
+
+type InviteIrcClientMessage struct {
+	Nick    string
+	Channel string
+}
+
+func (msg InviteIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg InviteIrcClientMessage) String() string {
+	return fmt.Sprintf("invite(%s, %s)", msg.Nick, msg.Channel)
+}
+
+// AwayIrcClientMessage sets the sender's away message, or clears it if
+// Message is empty.
+type AwayIrcClientMessage struct {
+	Message string
+}
+
+func (msg AwayIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg AwayIrcClientMessage) String() string {
+	return fmt.Sprintf("away(%s)", msg.Message)
+}
+
+// ListIrcClientMessage holds LIST's channel masks and ELIST conditions, which
+// are told apart when the request is processed.
+type ListIrcClientMessage struct {
+	Targets []string
+}
+
+func (msg ListIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg ListIrcClientMessage) String() string {
+	return fmt.Sprintf("list([%s])", strings.Join(msg.Targets, ", "))
+}
+
+type QuitIrcClientMessage struct {
+	Reason string
+}
+
+func (msg QuitIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg QuitIrcClientMessage) String() string {
+	return fmt.Sprintf("quit(%s)", msg.Reason)
+}
+
+type PingIrcClientMessage struct {
+	Token string
+}
+
+func (msg PingIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg PingIrcClientMessage) String() string {
+	return fmt.Sprintf("ping(%s)", msg.Token)
+}
+
+type PongIrcClientMessage struct {
+	Token string
+}
+
+func (msg PongIrcClientMessage) isIrcClientMessage() bool {
+	return true
+}
+
+func (msg PongIrcClientMessage) String() string {
+	return fmt.Sprintf("pong(%s)", msg.Token)
+}
+
 func InterpretIrc(msg *GenericIrcClientMessage) IrcClientMessage {
 	switch msg.Command {
 	case "NICK":
-		if len(msg.Args) < 1 {
+		if len(msg.Args) < 1 || msg.Args[0] == "" {
 			return &InvalidIrcClientMessage{
 				Command: "NICK",
 				MinArgs: 1,
@@ -183,23 +518,54 @@ func InterpretIrc(msg *GenericIrcClientMessage) IrcClientMessage {
 			Gecos: msg.Args[3],
 		}
 	case "PRIVMSG":
-		if len(msg.Args) < 2 {
+		if len(msg.Args) < 1 {
 			return &InvalidIrcClientMessage{
-				Command: "USER",
-				MinArgs: 2,
+				Command: "PRIVMSG",
+				MinArgs: 1,
 			}
 		}
+		if len(msg.Args) < 2 || msg.Args[1] == "" {
+			return &NoTextIrcClientMessage{"PRIVMSG"}
+		}
 		if strings.HasPrefix(msg.Args[0], "#") {
 			return &ChannelIrcClientMessage{
 				To:      msg.Args[0],
 				Message: msg.Args[1],
+				Tags:    msg.Tags.ClientOnly(),
 			}
 		}
 		return &PMIrcClientMessage{
 			To:      msg.Args[0],
 			Message: msg.Args[1],
+			Tags:    msg.Tags.ClientOnly(),
+		}
+	case "NOTICE":
+		if len(msg.Args) < 2 || msg.Args[1] == "" {
+			return &DroppedIrcClientMessage{"NOTICE"}
+		}
+		return &NoticeIrcClientMessage{
+			To:      msg.Args[0],
+			Message: msg.Args[1],
+			Tags:    msg.Tags.ClientOnly(),
+		}
+	case "TAGMSG":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "TAGMSG",
+				MinArgs: 1,
+			}
+		}
+		return &TagMsgIrcClientMessage{
+			To:   msg.Args[0],
+			Tags: msg.Tags.ClientOnly(),
 		}
 	case "CONNECT":
+		if len(msg.Args) == 1 {
+			// Connect to a configured link block by name.
+			return &ConnectIrcClientMessage{
+				Target: msg.Args[0],
+			}
+		}
 		if len(msg.Args) < 3 {
 			return &InvalidIrcClientMessage{
 				Command: "CONNECT",
@@ -220,6 +586,21 @@ func InterpretIrc(msg *GenericIrcClientMessage) IrcClientMessage {
 			Host:   msg.Args[1],
 			Port:   port,
 		}
+	case "REHASH":
+		return &RehashIrcClientMessage{}
+	case "MOTD":
+		return &MotdIrcClientMessage{}
+	case "OPER":
+		if len(msg.Args) < 2 {
+			return &InvalidIrcClientMessage{
+				Command: "OPER",
+				MinArgs: 2,
+			}
+		}
+		return &OperIrcClientMessage{
+			Name:     msg.Args[0],
+			Password: msg.Args[1],
+		}
 	case "JOIN":
 		if len(msg.Args) < 1 {
 			return &InvalidIrcClientMessage{
@@ -229,12 +610,44 @@ func InterpretIrc(msg *GenericIrcClientMessage) IrcClientMessage {
 		}
 		var keys []string = nil
 		if len(msg.Args) > 1 {
-			keys = strings.Split(msg.Args[0], ",")
+			keys = strings.Split(msg.Args[1], ",")
 		}
 		return &JoinIrcClientMessage{
 			Targets: strings.Split(msg.Args[0], ","),
 			Keys:    keys,
 		}
+	case "PART":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "PART",
+				MinArgs: 1,
+			}
+		}
+		reason := ""
+		if len(msg.Args) > 1 {
+			reason = msg.Args[1]
+		}
+		return &PartIrcClientMessage{
+			Targets: strings.Split(msg.Args[0], ","),
+			Reason:  reason,
+		}
+	case "TOPIC":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "TOPIC",
+				MinArgs: 1,
+			}
+		}
+		if len(msg.Args) == 1 {
+			return &TopicIrcClientMessage{
+				Target: msg.Args[0],
+			}
+		}
+		return &TopicIrcClientMessage{
+			Target: msg.Args[0],
+			Topic:  msg.Args[1],
+			Set:    true,
+		}
 	case "MODE":
 		if len(msg.Args) < 1 {
 			return &InvalidIrcClientMessage{
@@ -247,7 +660,9 @@ func InterpretIrc(msg *GenericIrcClientMessage) IrcClientMessage {
 			// Channel mode.
 			if len(msg.Args) == 1 {
 				// Request for the current channel mode.
-				return msg
+				return &ChannelModeQueryIrcClientMessage{
+					Target: tname,
+				}
 			} else {
 				return &ChannelModeChangeIrcClientMessage{
 					Target: tname,
@@ -255,10 +670,138 @@ func InterpretIrc(msg *GenericIrcClientMessage) IrcClientMessage {
 					Arg:    msg.Args[2:],
 				}
 			}
+		} else if len(msg.Args) == 1 {
+			return &UserModeIrcClientMessage{
+				Target: tname,
+			}
 		} else {
-			return msg
+			return &UserModeIrcClientMessage{
+				Target: tname,
+				Mode:   msg.Args[1],
+				Arg:    msg.Args[2:],
+			}
+		}
+	case "CAP":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "CAP",
+				MinArgs: 1,
+			}
+		}
+		arg := ""
+		if len(msg.Args) > 1 {
+			arg = msg.Args[1]
+		}
+		return &CapIrcClientMessage{
+			Subcommand: strings.ToUpper(msg.Args[0]),
+			Arg:        arg,
+		}
+	case "AUTHENTICATE":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "AUTHENTICATE",
+				MinArgs: 1,
+			}
+		}
+		return &AuthenticateIrcClientMessage{
+			Data: msg.Args[0],
+		}
+	case "WHOIS":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "WHOIS",
+				MinArgs: 1,
+			}
+		}
+		// WHOIS [server] nick[,nick...]. Every server answers the same way,
+		// so the optional server argument is ignored.
+		return &WhoisIrcClientMessage{
+			Targets: strings.Split(msg.Args[len(msg.Args)-1], ","),
+		}
+	case "WHO":
+		who := &WhoIrcClientMessage{}
+		if len(msg.Args) > 0 {
+			who.Mask = msg.Args[0]
+		}
+		if len(msg.Args) > 1 {
+			who.Flags = msg.Args[1]
+		}
+		return who
+	case "NAMES":
+		names := &NamesIrcClientMessage{}
+		if len(msg.Args) > 0 {
+			names.Targets = strings.Split(msg.Args[0], ",")
+		}
+		return names
+	case "KICK":
+		if len(msg.Args) < 2 {
+			return &InvalidIrcClientMessage{
+				Command: "KICK",
+				MinArgs: 2,
+			}
+		}
+		reason := ""
+		if len(msg.Args) > 2 {
+			reason = msg.Args[2]
+		}
+		return &KickIrcClientMessage{
+			Channel: msg.Args[0],
+			Targets: strings.Split(msg.Args[1], ","),
+			Reason:  reason,
+		}
+	case "INVITE":
+		if len(msg.Args) < 2 {
+			return &InvalidIrcClientMessage{
+				Command: "INVITE",
+				MinArgs: 2,
+			}
+		}
+		return &InviteIrcClientMessage{
+			Nick:    msg.Args[0],
+			Channel: msg.Args[1],
+		}
+	case "AWAY":
+		away := &AwayIrcClientMessage{}
+		if len(msg.Args) > 0 {
+			away.Message = msg.Args[0]
+		}
+		return away
+	case "LIST":
+		list := &ListIrcClientMessage{}
+		for _, arg := range msg.Args {
+			list.Targets = append(list.Targets, strings.Split(arg, ",")...)
+		}
+		return list
+	case "QUIT":
+		reason := ""
+		if len(msg.Args) > 0 {
+			reason = msg.Args[0]
+		}
+		return &QuitIrcClientMessage{
+			Reason: reason,
+		}
+	case "PING":
+		if len(msg.Args) < 1 {
+			return &InvalidIrcClientMessage{
+				Command: "PING",
+				MinArgs: 1,
+			}
+		}
+		return &PingIrcClientMessage{
+			Token: msg.Args[0],
+		}
+	case "PONG":
+		// The token is ignored; receiving anything at all resets the idle timer.
+		token := ""
+		if len(msg.Args) > 0 {
+			token = msg.Args[len(msg.Args)-1]
+		}
+		return &PongIrcClientMessage{
+			Token: token,
 		}
 	default:
-		return msg
+		return &UnknownIrcClientMessage{
+			Command: msg.Command,
+		}
 	}
 }
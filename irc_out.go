@@ -6,6 +6,10 @@ import (
 	"time"
 )
 
+// MaxIrcLineLen is the longest line that may be sent to a client, not counting
+// the trailing CRLF.
+const MaxIrcLineLen = 510
+
 type IrcNIH struct {
 	Nick  string
 	Ident string
@@ -20,6 +24,14 @@ type IrcMessage interface {
 	ToIrc(ircd *Ircd) string
 }
 
+// IrcCapAwareMessage is implemented by messages whose encoding depends on the
+// capabilities the recipient negotiated. ToIrcFor is used in place of ToIrc
+// when sending to a connection.
+type IrcCapAwareMessage interface {
+	IrcMessage
+	ToIrcFor(ircd *Ircd, caps CapSet) string
+}
+
 type IrcWelcomeBanner struct {
 	Nick, Ident, Host string
 }
@@ -49,23 +61,30 @@ type IrcWelcomeSupportedModes struct {
 }
 
 func (msg IrcWelcomeSupportedModes) ToIrc(ircd *Ircd) string {
-	// TODO: Use real modes when we actually support some.
-	return fmt.Sprintf(":%s 004 %s %s gossamer-dev CDFGNRSUWXabcdfgijklnopqrsuwxyz BIMNORSabcehiklmnopqstvz Iabehkloqv", ircd.node.Me.Name, msg.Nick, ircd.node.Me.Name)
+	return fmt.Sprintf(":%s 004 %s %s gossamer-dev %s %s %s", ircd.node.Me.Name, msg.Nick, ircd.node.Me.Name, SupportedUserModes(), SupportedChannelModes(), SupportedChannelParamModes())
+}
+
+type IrcFeature struct {
+	Name  string
+	Value string
+}
+
+func (f IrcFeature) String() string {
+	if f.Value != "" {
+		return fmt.Sprintf("%s=%s", strings.ToUpper(f.Name), f.Value)
+	}
+	return strings.ToUpper(f.Name)
 }
 
 type IrcWelcomeSupportedFeatures struct {
 	Nick    string
-	Feature map[string]string
+	Feature []IrcFeature
 }
 
 func (msg IrcWelcomeSupportedFeatures) ToIrc(ircd *Ircd) string {
 	list := make([]string, 0, len(msg.Feature))
-	for k, v := range msg.Feature {
-		if v != "" {
-			list = append(list, fmt.Sprintf("%s=%s", strings.ToUpper(k), v))
-		} else {
-			list = append(list, strings.ToUpper(k))
-		}
+	for _, feature := range msg.Feature {
+		list = append(list, feature.String())
 	}
 	return fmt.Sprintf(":%s 005 %s %s :are supported by this server", ircd.node.Me.Name, msg.Nick, strings.Join(list, " "))
 }
@@ -74,18 +93,283 @@ type IrcPrivateMessage struct {
 	From    IrcNIH
 	To      string
 	Message string
+	Tags    IrcTags
 }
 
 func (msg IrcPrivateMessage) ToIrc(ircd *Ircd) string {
 	return fmt.Sprintf(":%s PRIVMSG %s :%s", msg.From, msg.To, msg.Message)
 }
 
+func (msg IrcPrivateMessage) ToIrcFor(ircd *Ircd, caps CapSet) string {
+	return msg.Tags.Prefix(caps) + msg.ToIrc(ircd)
+}
+
+type IrcNoticeMessage struct {
+	From    IrcNIH
+	To      string
+	Message string
+	Tags    IrcTags
+}
+
+func (msg IrcNoticeMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s NOTICE %s :%s", msg.From, msg.To, msg.Message)
+}
+
+func (msg IrcNoticeMessage) ToIrcFor(ircd *Ircd, caps CapSet) string {
+	return msg.Tags.Prefix(caps) + msg.ToIrc(ircd)
+}
+
+// IrcTagMessage is a TAGMSG, which must only be sent to clients that
+// negotiated message-tags.
+type IrcTagMessage struct {
+	From IrcNIH
+	To   string
+	Tags IrcTags
+}
+
+func (msg IrcTagMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf("@%s :%s TAGMSG %s", msg.Tags, msg.From, msg.To)
+}
+
+func (msg IrcTagMessage) ToIrcFor(ircd *Ircd, caps CapSet) string {
+	msg.Tags = msg.Tags.For(caps)
+	return msg.ToIrc(ircd)
+}
+
+type IrcServerNotice struct {
+	To      string
+	Message string
+}
+
+func (msg IrcServerNotice) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s NOTICE %s :%s", ircd.node.Me.Name, msg.To, msg.Message)
+}
+
+type IrcAway struct {
+	To      string
+	Nick    string
+	Message string
+}
+
+func (msg IrcAway) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 301 %s %s :%s", ircd.node.Me.Name, msg.To, msg.Nick, msg.Message)
+}
+
+type IrcUnaway struct {
+	To string
+}
+
+func (msg IrcUnaway) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 305 %s :You are no longer marked as being away", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNowAway struct {
+	To string
+}
+
+func (msg IrcNowAway) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 306 %s :You have been marked as being away", ircd.node.Me.Name, msg.To)
+}
+
+type IrcInputTooLong struct {
+	To string
+}
+
+func (msg IrcInputTooLong) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 417 %s :Input line was too long", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNoSuchNick struct {
+	To   string
+	Nick string
+}
+
+func (msg IrcNoSuchNick) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 401 %s %s :No such nick/channel", ircd.node.Me.Name, msg.To, msg.Nick)
+}
+
+type IrcNoSuchChannel struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcNoSuchChannel) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 403 %s %s :No such channel", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcCannotSendToChan struct {
+	To      string
+	Channel string
+	Reason  string
+}
+
+func (msg IrcCannotSendToChan) ToIrc(ircd *Ircd) string {
+	reason := msg.Reason
+	if reason == "" {
+		reason = "Cannot send to channel"
+	}
+	return fmt.Sprintf(":%s 404 %s %s :%s", ircd.node.Me.Name, msg.To, msg.Channel, reason)
+}
+
+type IrcUnknownCommand struct {
+	To      string
+	Command string
+}
+
+func (msg IrcUnknownCommand) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 421 %s %s :Unknown command", ircd.node.Me.Name, msg.To, msg.Command)
+}
+
+type IrcNoTextToSend struct {
+	To string
+}
+
+func (msg IrcNoTextToSend) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 412 %s :No text to send", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNoNicknameGiven struct {
+	To string
+}
+
+func (msg IrcNoNicknameGiven) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 431 %s :No nickname given", ircd.node.Me.Name, msg.To)
+}
+
+type IrcErroneousNickname struct {
+	To   string
+	Nick string
+}
+
+func (msg IrcErroneousNickname) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 432 %s %s :Erroneous nickname", ircd.node.Me.Name, msg.To, msg.Nick)
+}
+
 type IrcNickInUse struct {
+	To   string
 	Nick string
 }
 
 func (msg IrcNickInUse) ToIrc(ircd *Ircd) string {
-	return fmt.Sprintf(":%s 433 %s :Nickname is already in use", ircd.node.Me.Name, msg.Nick)
+	return fmt.Sprintf(":%s 433 %s %s :Nickname is already in use", ircd.node.Me.Name, msg.To, msg.Nick)
+}
+
+type IrcUserNotInChannel struct {
+	To      string
+	Nick    string
+	Channel string
+}
+
+func (msg IrcUserNotInChannel) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 441 %s %s %s :They aren't on that channel", ircd.node.Me.Name, msg.To, msg.Nick, msg.Channel)
+}
+
+type IrcUserOnChannel struct {
+	To      string
+	Nick    string
+	Channel string
+}
+
+func (msg IrcUserOnChannel) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 443 %s %s %s :is already on channel", ircd.node.Me.Name, msg.To, msg.Nick, msg.Channel)
+}
+
+type IrcNotOnChannel struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcNotOnChannel) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 442 %s %s :You're not on that channel", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcNotRegistered struct {
+	To string
+}
+
+func (msg IrcNotRegistered) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 451 %s :You have not registered", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNeedMoreParams struct {
+	To      string
+	Command string
+}
+
+func (msg IrcNeedMoreParams) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 461 %s %s :Not enough parameters", ircd.node.Me.Name, msg.To, msg.Command)
+}
+
+type IrcAlreadyRegistered struct {
+	To string
+}
+
+func (msg IrcAlreadyRegistered) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 462 %s :You may not reregister", ircd.node.Me.Name, msg.To)
+}
+
+type IrcChannelIsFull struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcChannelIsFull) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 471 %s %s :Cannot join channel (+l)", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcInviteOnlyChan struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcInviteOnlyChan) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 473 %s %s :Cannot join channel (+i)", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcBannedFromChan struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcBannedFromChan) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 474 %s %s :Cannot join channel (+b)", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcBadChannelKey struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcBadChannelKey) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 475 %s %s :Cannot join channel (+k)", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcBanListFull struct {
+	To      string
+	Channel string
+	Mode    byte
+}
+
+func (msg IrcBanListFull) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 478 %s %s %c :Channel list is full", ircd.node.Me.Name, msg.To, msg.Channel, msg.Mode)
+}
+
+type IrcChanOpPrivsNeeded struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcChanOpPrivsNeeded) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 482 %s %s :You're not channel operator", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcNickMessage struct {
+	From IrcNIH
+	Nick string
+}
+
+func (msg IrcNickMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s NICK %s", msg.From, msg.Nick)
 }
 
 type IrcJoinMessage struct {
@@ -97,6 +381,15 @@ func (msg IrcJoinMessage) ToIrc(ircd *Ircd) string {
 	return fmt.Sprintf(":%s JOIN %s", msg.From, msg.To)
 }
 
+type IrcNoTopicMessage struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcNoTopicMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 331 %s %s :No topic is set", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
 type IrcTopicNumericMessage struct {
 	To      string
 	Channel string
@@ -118,35 +411,101 @@ func (msg IrcTopicOriginMessage) ToIrc(ircd *Ircd) string {
 	return fmt.Sprintf(":%s 333 %s %s %s %d", ircd.node.Me.Name, msg.To, msg.Channel, msg.Author, msg.Ts)
 }
 
+type IrcTopicMessage struct {
+	From  string
+	To    string
+	Topic string
+}
+
+func (msg IrcTopicMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s TOPIC %s :%s", msg.From, msg.To, msg.Topic)
+}
+
+// IrcChannelNameEntry is a member in a NAMES reply. Prefix holds every rank
+// the member has, highest first.
 type IrcChannelNameEntry struct {
 	Prefix string
-	Nick   string
+	NIH    IrcNIH
 }
 
 type IrcChannelNamesReply struct {
 	To      string
+	Symbol  string
 	Channel string
 	Name    []IrcChannelNameEntry
 }
 
 func (msg IrcChannelNamesReply) ToIrc(ircd *Ircd) string {
+	return msg.ToIrcFor(ircd, nil)
+}
+
+// ToIrcFor shows all prefixes to multi-prefix clients, and full
+// nick!ident@host entries to userhost-in-names clients.
+func (msg IrcChannelNamesReply) ToIrcFor(ircd *Ircd, caps CapSet) string {
 	names := make([]string, 0, len(msg.Name))
 	for _, entry := range msg.Name {
-		names = append(names, fmt.Sprintf("%s%s", entry.Prefix, entry.Nick))
+		prefix := entry.Prefix
+		if !caps.Has("multi-prefix") && len(prefix) > 1 {
+			prefix = prefix[:1]
+		}
+		name := entry.NIH.Nick
+		if caps.Has("userhost-in-names") {
+			name = entry.NIH.String()
+		}
+		names = append(names, prefix+name)
+	}
+	return fmt.Sprintf(":%s 353 %s %s %s :%s", ircd.node.Me.Name, msg.To, msg.Symbol, msg.Channel, strings.Join(names, " "))
+}
+
+type IrcEndOfNames struct {
+	To      string
+	Channel string
+}
+
+func (msg IrcEndOfNames) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 366 %s %s :End of /NAMES list", ircd.node.Me.Name, msg.To, msg.Channel)
+}
+
+type IrcChannelModeIs struct {
+	To      string
+	Channel string
+	Mode    string
+	Arg     []string
+}
+
+func (msg IrcChannelModeIs) ToIrc(ircd *Ircd) string {
+	space := ""
+	if len(msg.Arg) > 0 {
+		space = " "
 	}
-	return fmt.Sprintf(":%s 353 %s = %s :%s", ircd.node.Me.Name, msg.To, msg.Channel, strings.Join(names, " "))
+	return fmt.Sprintf(":%s 324 %s %s %s%s%s", ircd.node.Me.Name, msg.To, msg.Channel, msg.Mode, space, strings.Join(msg.Arg, " "))
+}
+
+type IrcChannelCreationTime struct {
+	To      string
+	Channel string
+	Ts      uint64
+}
+
+func (msg IrcChannelCreationTime) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 329 %s %s %d", ircd.node.Me.Name, msg.To, msg.Channel, msg.Ts)
 }
 
 type IrcChannelMessage struct {
 	From    IrcNIH
 	To      string
 	Message string
+	Tags    IrcTags
 }
 
 func (msg IrcChannelMessage) ToIrc(ircd *Ircd) string {
 	return fmt.Sprintf(":%s PRIVMSG %s :%s", msg.From, msg.To, msg.Message)
 }
 
+func (msg IrcChannelMessage) ToIrcFor(ircd *Ircd, caps CapSet) string {
+	return msg.Tags.Prefix(caps) + msg.ToIrc(ircd)
+}
+
 type IrcPartMessage struct {
 	From    IrcNIH
 	To      string
@@ -154,9 +513,43 @@ type IrcPartMessage struct {
 }
 
 func (msg IrcPartMessage) ToIrc(ircd *Ircd) string {
+	if msg.Message == "" {
+		return fmt.Sprintf(":%s PART %s", msg.From, msg.To)
+	}
 	return fmt.Sprintf(":%s PART %s :%s", msg.From, msg.To, msg.Message)
 }
 
+type IrcKickMessage struct {
+	From    string
+	To      string
+	Target  string
+	Message string
+}
+
+func (msg IrcKickMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s KICK %s %s :%s", msg.From, msg.To, msg.Target, msg.Message)
+}
+
+type IrcInviteMessage struct {
+	From    IrcNIH
+	Nick    string
+	Channel string
+}
+
+func (msg IrcInviteMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s INVITE %s :%s", msg.From, msg.Nick, msg.Channel)
+}
+
+type IrcInviting struct {
+	To      string
+	Nick    string
+	Channel string
+}
+
+func (msg IrcInviting) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 341 %s %s %s", ircd.node.Me.Name, msg.To, msg.Nick, msg.Channel)
+}
+
 type IrcChannelModeMessage struct {
 	From string
 	To   string
@@ -171,3 +564,459 @@ func (msg IrcChannelModeMessage) ToIrc(ircd *Ircd) string {
 	}
 	return fmt.Sprintf(":%s MODE %s %s%s%s", msg.From, msg.To, msg.Mode, space, strings.Join(msg.Arg, " "))
 }
+
+type IrcAwayMessage struct {
+	From    IrcNIH
+	Message string
+}
+
+func (msg IrcAwayMessage) ToIrc(ircd *Ircd) string {
+	if msg.Message == "" {
+		return fmt.Sprintf(":%s AWAY", msg.From)
+	}
+	return fmt.Sprintf(":%s AWAY :%s", msg.From, msg.Message)
+}
+
+type IrcQuitMessage struct {
+	From    IrcNIH
+	Message string
+}
+
+func (msg IrcQuitMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s QUIT :%s", msg.From, msg.Message)
+}
+
+// IrcClosingLink is the ERROR sent to a client just before its connection is
+// closed.
+type IrcClosingLink struct {
+	Host   string
+	Reason string
+}
+
+func (msg IrcClosingLink) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf("ERROR :Closing Link: %s (%s)", msg.Host, msg.Reason)
+}
+
+type IrcPingMessage struct {
+	Token string
+}
+
+func (msg IrcPingMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf("PING :%s", msg.Token)
+}
+
+type IrcPongMessage struct {
+	Token string
+}
+
+func (msg IrcPongMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s PONG %s :%s", ircd.node.Me.Name, ircd.node.Me.Name, msg.Token)
+}
+
+type IrcCapMessage struct {
+	To         string
+	Subcommand string
+	Caps       []string
+	More       bool
+}
+
+func (msg IrcCapMessage) ToIrc(ircd *Ircd) string {
+	more := ""
+	if msg.More {
+		more = "* "
+	}
+	return fmt.Sprintf(":%s CAP %s %s %s:%s", ircd.node.Me.Name, msg.To, msg.Subcommand, more, strings.Join(msg.Caps, " "))
+}
+
+type IrcInvalidCapCommand struct {
+	To         string
+	Subcommand string
+}
+
+func (msg IrcInvalidCapCommand) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 410 %s %s :Invalid CAP command", ircd.node.Me.Name, msg.To, msg.Subcommand)
+}
+
+type IrcAuthenticateMessage struct {
+	Data string
+}
+
+func (msg IrcAuthenticateMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf("AUTHENTICATE %s", msg.Data)
+}
+
+type IrcLoggedIn struct {
+	To      string
+	NIH     IrcNIH
+	Account string
+}
+
+func (msg IrcLoggedIn) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 900 %s %s %s :You are now logged in as %s", ircd.node.Me.Name, msg.To, msg.NIH, msg.Account, msg.Account)
+}
+
+type IrcSaslSuccess struct {
+	To string
+}
+
+func (msg IrcSaslSuccess) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 903 %s :SASL authentication successful", ircd.node.Me.Name, msg.To)
+}
+
+type IrcSaslFail struct {
+	To string
+}
+
+func (msg IrcSaslFail) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 904 %s :SASL authentication failed", ircd.node.Me.Name, msg.To)
+}
+
+type IrcSaslAborted struct {
+	To string
+}
+
+func (msg IrcSaslAborted) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 906 %s :SASL authentication aborted", ircd.node.Me.Name, msg.To)
+}
+
+type IrcSaslAlready struct {
+	To string
+}
+
+func (msg IrcSaslAlready) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 907 %s :You have already authenticated using SASL", ircd.node.Me.Name, msg.To)
+}
+
+type IrcSaslMechs struct {
+	To         string
+	Mechanisms string
+}
+
+func (msg IrcSaslMechs) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 908 %s %s :are available SASL mechanisms", ircd.node.Me.Name, msg.To, msg.Mechanisms)
+}
+
+type IrcWhoisUser struct {
+	To    string
+	NIH   IrcNIH
+	Gecos string
+}
+
+func (msg IrcWhoisUser) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 311 %s %s %s %s * :%s", ircd.node.Me.Name, msg.To, msg.NIH.Nick, msg.NIH.Ident, msg.NIH.Host, msg.Gecos)
+}
+
+type IrcWhoisServer struct {
+	To     string
+	Nick   string
+	Server string
+	Desc   string
+}
+
+func (msg IrcWhoisServer) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 312 %s %s %s :%s", ircd.node.Me.Name, msg.To, msg.Nick, msg.Server, msg.Desc)
+}
+
+type IrcWhoisOperator struct {
+	To   string
+	Nick string
+}
+
+func (msg IrcWhoisOperator) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 313 %s %s :is an IRC operator", ircd.node.Me.Name, msg.To, msg.Nick)
+}
+
+type IrcWhoisIdle struct {
+	To     string
+	Nick   string
+	Idle   uint64
+	Signon uint64
+}
+
+func (msg IrcWhoisIdle) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 317 %s %s %d %d :seconds idle, signon time", ircd.node.Me.Name, msg.To, msg.Nick, msg.Idle, msg.Signon)
+}
+
+type IrcEndOfWhois struct {
+	To   string
+	Nick string
+}
+
+func (msg IrcEndOfWhois) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 318 %s %s :End of /WHOIS list", ircd.node.Me.Name, msg.To, msg.Nick)
+}
+
+type IrcWhoisChannels struct {
+	To       string
+	Nick     string
+	Channels []string
+}
+
+func (msg IrcWhoisChannels) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 319 %s %s :%s", ircd.node.Me.Name, msg.To, msg.Nick, strings.Join(msg.Channels, " "))
+}
+
+type IrcWhoisAccount struct {
+	To      string
+	Nick    string
+	Account string
+}
+
+func (msg IrcWhoisAccount) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 330 %s %s %s :is logged in as", ircd.node.Me.Name, msg.To, msg.Nick, msg.Account)
+}
+
+type IrcWhoisSecure struct {
+	To   string
+	Nick string
+}
+
+func (msg IrcWhoisSecure) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 671 %s %s :is using a secure connection", ircd.node.Me.Name, msg.To, msg.Nick)
+}
+
+type IrcWhoReply struct {
+	To      string
+	Channel string
+	NIH     IrcNIH
+	Server  string
+	Flags   string
+	Hops    int
+	Gecos   string
+}
+
+func (msg IrcWhoReply) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 352 %s %s %s %s %s %s %s :%d %s", ircd.node.Me.Name, msg.To, msg.Channel, msg.NIH.Ident, msg.NIH.Host, msg.Server, msg.NIH.Nick, msg.Flags, msg.Hops, msg.Gecos)
+}
+
+type IrcWhoxReply struct {
+	To     string
+	Fields []string
+}
+
+func (msg IrcWhoxReply) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 354 %s %s", ircd.node.Me.Name, msg.To, strings.Join(msg.Fields, " "))
+}
+
+type IrcEndOfWho struct {
+	To   string
+	Mask string
+}
+
+func (msg IrcEndOfWho) ToIrc(ircd *Ircd) string {
+	mask := msg.Mask
+	if mask == "" {
+		mask = "*"
+	}
+	return fmt.Sprintf(":%s 315 %s %s :End of /WHO list", ircd.node.Me.Name, msg.To, mask)
+}
+
+// IrcChannelListEntry is one entry of a channel mask list, sent with the
+// numeric for that list (367, 348, 346 or 728).
+type IrcChannelListEntry struct {
+	Numeric string
+	To      string
+	Channel string
+	Mode    string
+	Mask    string
+	SetBy   string
+	SetAt   uint64
+}
+
+func (msg IrcChannelListEntry) ToIrc(ircd *Ircd) string {
+	mode := ""
+	if msg.Mode != "" {
+		mode = msg.Mode + " "
+	}
+	return fmt.Sprintf(":%s %s %s %s %s%s %s %d", ircd.node.Me.Name, msg.Numeric, msg.To, msg.Channel, mode, msg.Mask, msg.SetBy, msg.SetAt)
+}
+
+type IrcEndOfChannelList struct {
+	Numeric string
+	To      string
+	Channel string
+	Mode    string
+	Text    string
+}
+
+func (msg IrcEndOfChannelList) ToIrc(ircd *Ircd) string {
+	mode := ""
+	if msg.Mode != "" {
+		mode = msg.Mode + " "
+	}
+	return fmt.Sprintf(":%s %s %s %s %s:%s", ircd.node.Me.Name, msg.Numeric, msg.To, msg.Channel, mode, msg.Text)
+}
+
+type IrcTryAgain struct {
+	To      string
+	Command string
+}
+
+func (msg IrcTryAgain) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 263 %s %s :Please wait a while and try again.", ircd.node.Me.Name, msg.To, msg.Command)
+}
+
+type IrcListStart struct {
+	To string
+}
+
+func (msg IrcListStart) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 321 %s Channel :Users  Name", ircd.node.Me.Name, msg.To)
+}
+
+type IrcListReply struct {
+	To      string
+	Channel string
+	Users   int
+	Topic   string
+}
+
+func (msg IrcListReply) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 322 %s %s %d :%s", ircd.node.Me.Name, msg.To, msg.Channel, msg.Users, msg.Topic)
+}
+
+type IrcListEnd struct {
+	To string
+}
+
+func (msg IrcListEnd) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 323 %s :End of /LIST", ircd.node.Me.Name, msg.To)
+}
+
+type IrcUserModeIs struct {
+	To    string
+	Modes string
+}
+
+func (msg IrcUserModeIs) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 221 %s %s", ircd.node.Me.Name, msg.To, msg.Modes)
+}
+
+type IrcSnomaskIs struct {
+	To   string
+	Mask string
+}
+
+func (msg IrcSnomaskIs) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 008 %s +%s :Server notice mask", ircd.node.Me.Name, msg.To, msg.Mask)
+}
+
+type IrcUnknownModeFlag struct {
+	To string
+}
+
+func (msg IrcUnknownModeFlag) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 501 %s :Unknown MODE flag", ircd.node.Me.Name, msg.To)
+}
+
+type IrcUsersDontMatch struct {
+	To string
+}
+
+func (msg IrcUsersDontMatch) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 502 %s :Can't change mode for other users", ircd.node.Me.Name, msg.To)
+}
+
+type IrcUserModeMessage struct {
+	From   IrcNIH
+	Target string
+	Modes  string
+}
+
+func (msg IrcUserModeMessage) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s MODE %s :%s", msg.From, msg.Target, msg.Modes)
+}
+
+type IrcYoureOper struct {
+	To string
+}
+
+func (msg IrcYoureOper) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 381 %s :You are now an IRC operator", ircd.node.Me.Name, msg.To)
+}
+
+type IrcPasswordMismatch struct {
+	To string
+}
+
+func (msg IrcPasswordMismatch) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 464 %s :Password incorrect", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNoPrivileges struct {
+	To string
+}
+
+func (msg IrcNoPrivileges) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 481 %s :Permission Denied- You're not an IRC operator", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNoOperHost struct {
+	To string
+}
+
+func (msg IrcNoOperHost) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 491 %s :No O-lines for your host", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNoPrivs struct {
+	To        string
+	Privilege string
+}
+
+func (msg IrcNoPrivs) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 723 %s %s :Insufficient oper privileges.", ircd.node.Me.Name, msg.To, msg.Privilege)
+}
+
+type IrcRehashing struct {
+	To   string
+	File string
+}
+
+func (msg IrcRehashing) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 382 %s %s :Rehashing", ircd.node.Me.Name, msg.To, msg.File)
+}
+
+type IrcNoSuchServer struct {
+	To     string
+	Server string
+}
+
+func (msg IrcNoSuchServer) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 402 %s %s :No such server", ircd.node.Me.Name, msg.To, msg.Server)
+}
+
+type IrcMotdStart struct {
+	To string
+}
+
+func (msg IrcMotdStart) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 375 %s :- %s Message of the day - ", ircd.node.Me.Name, msg.To, ircd.node.Me.Name)
+}
+
+type IrcMotdLine struct {
+	To   string
+	Line string
+}
+
+// ToIrc cuts the line short if it would otherwise be too long to send.
+func (msg IrcMotdLine) ToIrc(ircd *Ircd) string {
+	prefix := fmt.Sprintf(":%s 372 %s :- ", ircd.node.Me.Name, msg.To)
+	return prefix + TruncateText(msg.Line, MaxIrcLineLen-len(prefix))
+}
+
+type IrcEndOfMotd struct {
+	To string
+}
+
+func (msg IrcEndOfMotd) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 376 %s :End of /MOTD command.", ircd.node.Me.Name, msg.To)
+}
+
+type IrcNoMotd struct {
+	To string
+}
+
+func (msg IrcNoMotd) ToIrc(ircd *Ircd) string {
+	return fmt.Sprintf(":%s 422 %s :MOTD File is missing", ircd.node.Me.Name, msg.To)
+}
@@ -5,10 +5,15 @@ import (
 	"crypto/x509"
 	"fmt"
 	"github.com/gossamer-irc/lib"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"unicode/utf8"
 )
@@ -25,9 +30,39 @@ type Ircd struct {
 	connByClient map[*lib.Client]*IrcConnection
 	pending      map[*IrcConnection]*PendingClient
 
+	// streams holds the rest of each long reply, such as LIST, that is
+	// waiting for room in its connection's sendQ.
+	streams map[*IrcConnection][]IrcMessage
+
+	// tlsCert and tlsCaPool are replaced by a rehash while listeners may be
+	// reading them for a handshake, so they're guarded by tlsLock.
+	tlsLock   sync.RWMutex
 	tlsCert   tls.Certificate
 	tlsCaPool *x509.CertPool
 
+	pingInterval        time.Duration
+	registrationTimeout time.Duration
+
+	// caps maps each capability offered through CAP LS to its value, if any.
+	caps map[string]string
+
+	accounts AccountStore
+
+	// cloakKey keys the hosts shown for clients with +x. It must be the same
+	// on every server.
+	cloakKey string
+
+	// opers maps oper block names to the blocks used by OPER.
+	opers map[string]*OperBlock
+
+	// The configuration file, as last applied, and what it set up.
+	configPath string
+	config     *LoadedConfig
+	listeners  map[string]activeListener
+	links      map[string]LinkConfig
+	motd       []string
+	sighup     chan os.Signal
+
 	wg *sync.WaitGroup
 }
 
@@ -46,39 +81,111 @@ func NewIrcd(network, server, serverDesc, subnet string, wg *sync.WaitGroup) (ir
 		clientByConn: make(map[*IrcConnection]*lib.Client),
 		connByClient: make(map[*lib.Client]*IrcConnection),
 		pending:      make(map[*IrcConnection]*PendingClient),
-		wg:           wg,
+		streams:      make(map[*IrcConnection][]IrcMessage),
+		opers:        make(map[string]*OperBlock),
+		listeners:    make(map[string]activeListener),
+		links:        make(map[string]LinkConfig),
+		caps: map[string]string{
+			"cap-notify":        "",
+			"message-tags":      "",
+			"multi-prefix":      "",
+			"userhost-in-names": "",
+			"invite-notify":     "",
+			"away-notify":       "",
+			"server-time":       "",
+			"account-tag":       "",
+		},
+		wg: wg,
 	}
 	ircd.node = lib.NewNode(config, ircd, wg)
 	return
 }
 
-func (ircd *Ircd) LoadTls(caFile, certFile, keyFile string) {
+// LoadTls loads the certificate and CA used for new handshakes. The current
+// ones are kept if loading fails.
+func (ircd *Ircd) LoadTls(caFile, certFile, keyFile string) error {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
-		log.Fatalf("Failed to load TLS certificate: %s", err)
+		return fmt.Errorf("Failed to load TLS certificate: %s", err)
 	}
-	ircd.tlsCert = cert
 
 	caBytes, err := ioutil.ReadFile(caFile)
 	if err != nil {
-		log.Fatalf("Failed to load TLS CA certificate: %s", err)
+		return fmt.Errorf("Failed to load TLS CA certificate: %s", err)
 	}
-	ircd.tlsCaPool = x509.NewCertPool()
+	caPool := x509.NewCertPool()
 	log.Printf("Ca bytes: %d", len(caBytes))
-	ok := ircd.tlsCaPool.AppendCertsFromPEM(caBytes)
+	ok := caPool.AppendCertsFromPEM(caBytes)
 	if !ok {
-		log.Fatalf("Failed to load TLS CA certificate: invalid")
+		return fmt.Errorf("Failed to load TLS CA certificate: invalid")
+	}
+
+	ircd.tlsLock.Lock()
+	defer ircd.tlsLock.Unlock()
+	ircd.tlsCert = cert
+	ircd.tlsCaPool = caPool
+	return nil
+}
+
+// ServerTlsConfig returns the TLS configuration for a listener. It picks up
+// the certificate and CA in use at the time of each handshake.
+func (ircd *Ircd) ServerTlsConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			ircd.tlsLock.RLock()
+			defer ircd.tlsLock.RUnlock()
+			return &tls.Config{
+				Certificates: []tls.Certificate{ircd.tlsCert},
+				RootCAs:      ircd.tlsCaPool,
+				ClientCAs:    ircd.tlsCaPool,
+				ServerName:   ircd.node.Me.Name,
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}
+}
+
+// WatchConfig remembers the configuration file to reload on REHASH, and
+// reloads it whenever the process receives SIGHUP.
+func (ircd *Ircd) WatchConfig(path string) {
+	ircd.configPath = path
+	ircd.sighup = make(chan os.Signal, 1)
+	signal.Notify(ircd.sighup, syscall.SIGHUP)
+}
+
+// SetTimeouts configures how long a client may stay idle before it is sent a
+// PING (and, after the same period again, disconnected), and how long a new
+// connection may take to register. A zero duration disables the timeout.
+// Connections keep the values they were opened with.
+func (ircd *Ircd) SetTimeouts(pingInterval, registrationTimeout time.Duration) {
+	ircd.pingInterval = pingInterval
+	ircd.registrationTimeout = registrationTimeout
+}
+
+// SetAccountStore sets the store SASL logins are checked against, and starts
+// offering the sasl capability.
+func (ircd *Ircd) SetAccountStore(accounts AccountStore) {
+	ircd.accounts = accounts
+	if accounts == nil {
+		ircd.WithdrawCap("sasl")
+		return
+	}
+	if _, offered := ircd.caps["sasl"]; !offered {
+		ircd.AdvertiseCap("sasl", SaslMechanisms)
 	}
 }
 
 func (ircd *Ircd) AcceptPendingClient(pc *PendingClient) {
 	delete(ircd.pending, pc.Conn)
 	client := &lib.Client{
-		Nick:   pc.Nick,
-		Ident:  pc.Ident,
-		Host:   pc.Host,
-		Gecos:  pc.Gecos,
-		Subnet: pc.Subnet,
+		Nick:    pc.Nick,
+		Ident:   pc.Ident,
+		Host:    pc.Host,
+		Gecos:   pc.Gecos,
+		Subnet:  pc.Subnet,
+		Account: pc.Account,
+		Secure:  pc.Conn.Secure(),
+		Signon:  pc.Conn.signon,
 	}
 	err := ircd.node.AttachClient(client)
 	if err != nil {
@@ -87,15 +194,21 @@ func (ircd *Ircd) AcceptPendingClient(pc *PendingClient) {
 	}
 	ircd.clientByConn[pc.Conn] = client
 	ircd.connByClient[client] = pc.Conn
+	pc.Conn.SetClient(client)
 
 	// Send the welcome.
 	pc.Conn.Send(&IrcWelcomeBanner{client.Nick, client.Ident, client.Host})
 	pc.Conn.Send(&IrcWelcomeHost{client.Nick})
 	pc.Conn.Send(&IrcWelcomeCreated{client.Nick})
 	pc.Conn.Send(&IrcWelcomeSupportedModes{client.Nick})
+	ircd.SendSupportedFeatures(pc.Conn, client)
+	ircd.SendMotd(pc.Conn, client)
+	ircd.SendServerNotice(SnomaskClients, "Client connecting: %s (%s@%s)", client.Nick, client.Ident, client.Host)
 }
 
 func (ircd *Ircd) Run() {
+	streamTicker := time.NewTicker(StreamPollInterval)
+	defer streamTicker.Stop()
 	for {
 		select {
 		case conn := <-ircd.newConn:
@@ -104,11 +217,27 @@ func (ircd *Ircd) Run() {
 				continue
 			}
 			irc := NewIrcConnection(ircd, conn.NetConn, conn.NetConn, ircd.connEvent)
-			pc := NewPendingClient(ircd, irc, ircd.node.DefaultSubnet, conn.NetConn.RemoteAddr().String())
+			pc := NewPendingClient(ircd, irc, ircd.node.DefaultSubnet, ClientHost(conn.NetConn.RemoteAddr()))
 			ircd.pending[irc] = pc
 		case event := <-ircd.connEvent:
 			if event.Err != nil {
 				log.Printf("Error: %s", event.Err)
+				reason := event.Err.Error()
+				if event.Err == io.EOF {
+					reason = "Remote host closed the connection"
+				}
+				ircd.Disconnect(event.Connection, reason)
+				continue
+			}
+			if _, idle := event.Message.(*IdleIrcClientMessage); idle {
+				event.Connection.Send(&IrcPingMessage{ircd.node.Me.Name})
+				continue
+			}
+			if verified, ok := event.Message.(*VerifiedIrcClientMessage); ok {
+				event.Connection.verifying = false
+				if ircd.pending[event.Connection] != nil || ircd.clientByConn[event.Connection] != nil {
+					verified.Done()
+				}
 				continue
 			}
 			pc, found := ircd.pending[event.Connection]
@@ -120,6 +249,10 @@ func (ircd *Ircd) Run() {
 			if found {
 				ircd.Handle(event.Connection, client, event.Message)
 			}
+		case <-streamTicker.C:
+			ircd.FlushStreams()
+		case <-ircd.sighup:
+			ircd.Rehash()
 		case event := <-ircd.linkEvent:
 			log.Printf("Connection from %s", event.Server)
 			ircd.node.Do(func() {
@@ -129,19 +262,64 @@ func (ircd *Ircd) Run() {
 	}
 }
 
+// ClientHost returns the host for a client connecting from addr: its IP
+// address, without the port. An IPv6 address starting with ':' gets a
+// leading '0' so it can't be taken for a trailing parameter.
+func ClientHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	if strings.HasPrefix(host, ":") {
+		host = "0" + host
+	}
+	return host
+}
+
+// Disconnect closes a client connection, whether or not it has completed
+// registration, after sending it an ERROR with the reason. Registered clients are also detached from the node, which
+// notifies everyone sharing a channel with them.
+func (ircd *Ircd) Disconnect(irc *IrcConnection, reason string) {
+	delete(ircd.streams, irc)
+	if pc, found := ircd.pending[irc]; found {
+		irc.Send(&IrcClosingLink{pc.Host, reason})
+		irc.Close()
+		delete(ircd.pending, irc)
+		return
+	}
+	client, found := ircd.clientByConn[irc]
+	if !found {
+		irc.Close()
+		return
+	}
+	irc.Send(&IrcClosingLink{client.Host, reason})
+	irc.Close()
+	delete(ircd.clientByConn, irc)
+	delete(ircd.connByClient, client)
+	ircd.node.DetachClient(client, reason)
+	ircd.SendServerNotice(SnomaskClients, "Client exiting: %s (%s@%s) [%s]", client.Nick, client.Ident, client.Host, reason)
+}
+
+func quitReason(message string) string {
+	if message == "" {
+		return "Client Quit"
+	}
+	return fmt.Sprintf("Quit: %s", message)
+}
+
 func (ircd *Ircd) FindClientByRef(context *lib.Client, ref string) (client *lib.Client, found bool) {
 	parts := strings.SplitN(ref, ":", 2)
 	search := context.Subnet
 	nick := parts[0]
 	if len(parts) > 1 {
-		search, found = ircd.node.Subnet[strings.ToLower(parts[0])]
+		search, found = ircd.node.Subnet[FoldName(parts[0])]
 		if !found {
 			return
 		}
 		nick = parts[1]
 	}
 
-	client, found = search.Client[strings.ToLower(nick)]
+	client, found = search.Client[FoldName(nick)]
 	return
 }
 
@@ -153,58 +331,116 @@ func (ircd *Ircd) ExpandChannelRef(context *lib.Client, ref string) (channelName
 	if len(parts) == 2 {
 		qualified = true
 		channelName = parts[1]
-		subnet, found = ircd.node.Subnet[strings.ToLower(parts[0])]
+		subnet, found = ircd.node.Subnet[FoldName(parts[0])]
+	}
+	return
+}
+
+// FindChannelByRef resolves a "#channel" or "#subnet:channel" reference as seen
+// by the context client.
+func (ircd *Ircd) FindChannelByRef(context *lib.Client, ref string) (channel *lib.Channel, found bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return
+	}
+	channelName, subnet, found, _ := ircd.ExpandChannelRef(context, ref[1:])
+	if !found {
+		return
 	}
+	channel, found = subnet.Channel[channelName]
 	return
 }
 
-func (_ *Ircd) ClientAsSeenBy(client, context *lib.Client) IrcNIH {
-	if client.Subnet == context.Subnet {
-		return IrcNIH{client.Nick, client.Ident, client.Host}
+// NickAsSeenBy renders a nick from the given subnet the way context sees it,
+// qualifying it with the subnet name when that differs from context's own.
+func (_ *Ircd) NickAsSeenBy(subnet *lib.Subnet, nick string, context *lib.Client) string {
+	if subnet == context.Subnet {
+		return nick
 	}
-	return IrcNIH{fmt.Sprintf("%s:%s", client.Subnet.Name, client.Nick), client.Ident, client.Host}
+	return fmt.Sprintf("%s:%s", subnet.Name, nick)
+}
+
+func (ircd *Ircd) ClientAsSeenBy(client, context *lib.Client) IrcNIH {
+	return IrcNIH{ircd.NickAsSeenBy(client.Subnet, client.Nick, context), client.Ident, ircd.HostAsSeenBy(client, context)}
 }
 
 func (ircd *Ircd) Handle(irc *IrcConnection, client *lib.Client, rawEvent IrcClientMessage) {
 	switch event := rawEvent.(type) {
 	case *PMIrcClientMessage:
+		ircd.MarkActive(irc, client)
 		// Lookup the recepient.
 		to, found := ircd.FindClientByRef(client, event.To)
 		if !found {
-			// TODO: Send error saying they're not found.
+			irc.Send(&IrcNoSuchNick{client.Nick, event.To})
 			return
 		}
-		ircd.node.PrivateMessage(client, to, event.Message)
+		ircd.node.PrivateMessage(client, to, event.Message, RelayTags(client, event.Tags))
+		if to.Away != "" {
+			irc.Send(&IrcAway{client.Nick, ircd.ClientAsSeenBy(to, client).Nick, to.Away})
+		}
+	case *NoticeIrcClientMessage:
+		ircd.MarkActive(irc, client)
+		ircd.ClientNotice(client, event)
+	case *TagMsgIrcClientMessage:
+		ircd.ClientTagMsg(client, irc, event)
+	case *OperIrcClientMessage:
+		ircd.ClientOper(client, irc, event)
 	case *ConnectIrcClientMessage:
+		if !ircd.CheckPrivilege(client, irc, PrivConnect) {
+			return
+		}
+		if event.Host == "" {
+			link, found := ircd.links[strings.ToLower(event.Target)]
+			if !found {
+				irc.Send(&IrcNoSuchServer{client.Nick, event.Target})
+				return
+			}
+			event.Target, event.Host, event.Port = link.Name, link.Host, link.Port
+		}
+		ircd.SendServerNotice(SnomaskLinks, "%s is connecting to %s (%s:%d)", client.Nick, event.Target, event.Host, event.Port)
 		ircd.InitiateConnection(event.Target, event.Host, event.Port)
 	case *JoinIrcClientMessage:
 		ircd.ClientJoin(client, irc, event)
+	case *PartIrcClientMessage:
+		ircd.ClientPart(client, irc, event)
+	case *TopicIrcClientMessage:
+		ircd.ClientTopic(client, irc, event)
+	case *KickIrcClientMessage:
+		ircd.ClientKick(client, irc, event)
+	case *InviteIrcClientMessage:
+		ircd.ClientInvite(client, irc, event)
 	case *ChannelIrcClientMessage:
-		channelName, subnet, found, qualified := ircd.ExpandChannelRef(client, event.To[1:])
-		if !qualified || !found {
-			// TODO: better error handling
-			log.Printf("Channel not found [%s] - %v / %v", event.To, found, qualified)
+		ircd.MarkActive(irc, client)
+		channel, found := ircd.FindChannelByRef(client, event.To)
+		if !found {
+			irc.Send(&IrcNoSuchChannel{client.Nick, event.To})
 			return
 		}
-
-		channel, foundChan := subnet.Channel[channelName]
-		if !foundChan {
-			log.Printf("Failed to find channel %s in subnet %s", channelName, subnet.Name)
-			// TODO: send channel not found error
+		if refusal := ircd.CheckChannelMessage(client, channel); refusal != nil {
+			irc.Send(refusal)
 			return
 		}
 
-		ircd.node.ChannelMessage(client, channel, event.Message)
+		ircd.node.ChannelMessage(client, channel, event.Message, RelayTags(client, event.Tags))
 	case *ChannelModeChangeIrcClientMessage:
-		channelName, subnet, found, qualified := ircd.ExpandChannelRef(client, event.Target[1:])
-		if !qualified || !found {
-			log.Printf("Channel not found [%s] - %v / %v", event.Target, found, qualified)
+		channel, found := ircd.FindChannelByRef(client, event.Target)
+		if !found {
+			irc.Send(&IrcNoSuchChannel{client.Nick, event.Target})
 			return
 		}
-
-		channel, foundChan := subnet.Channel[channelName]
-		if !foundChan {
-			log.Printf("Failed to find channel %s in subnet %s", channelName, subnet.Name)
+		if len(event.Arg) == 0 && IsListQuery(event.Mode) {
+			if !ChannelVisibleTo(channel, client) {
+				irc.Send(&IrcNotOnChannel{client.Nick, event.Target})
+				return
+			}
+			ircd.SendChannelLists(irc, client, channel, event.Mode)
+			return
+		}
+		if MembershipRank(channel.Member[client]) < RankHalfop {
+			irc.Send(&IrcChanOpPrivsNeeded{client.Nick, event.Target})
+			return
+		}
+		if letter, ok := CheckListLimits(channel, event.Mode, event.Arg); !ok {
+			irc.Send(&IrcBanListFull{client.Nick, event.Target, letter})
 			return
 		}
 
@@ -214,16 +450,96 @@ func (ircd *Ircd) Handle(irc *IrcConnection, client *lib.Client, rawEvent IrcCli
 		})
 
 		ircd.node.ChangeChannelMode(client, channel, delta, memberDelta)
+	case *CapIrcClientMessage:
+		ircd.HandleCap(irc, client.Nick, event)
+	case *AuthenticateIrcClientMessage:
+		irc.Send(&IrcAlreadyRegistered{client.Nick})
+	case *QuitIrcClientMessage:
+		ircd.Disconnect(irc, quitReason(event.Reason))
+	case *PingIrcClientMessage:
+		irc.Send(&IrcPongMessage{event.Token})
+	case *NickIrcClientMessage:
+		ircd.ClientNick(client, irc, event)
+	case *WhoisIrcClientMessage:
+		ircd.ClientWhois(client, irc, event)
+	case *WhoIrcClientMessage:
+		ircd.ClientWho(client, irc, event)
+	case *AwayIrcClientMessage:
+		message := TruncateText(event.Message, MaxAwayLen)
+		ircd.node.SetAway(client, message)
+		if message == "" {
+			irc.Send(&IrcUnaway{client.Nick})
+		} else {
+			irc.Send(&IrcNowAway{client.Nick})
+		}
+	case *NamesIrcClientMessage:
+		ircd.ClientNames(client, irc, event)
+	case *ListIrcClientMessage:
+		ircd.ClientList(client, irc, event)
+	case *UserModeIrcClientMessage:
+		ircd.ClientUserMode(client, irc, event)
+	case *ChannelModeQueryIrcClientMessage:
+		channel, found := ircd.FindChannelByRef(client, event.Target)
+		if !found {
+			irc.Send(&IrcNoSuchChannel{client.Nick, event.Target})
+			return
+		}
+		chanName := fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
+		_, member := channel.Member[client]
+		modes, args := ChannelModeString(channel, member)
+		irc.Send(&IrcChannelModeIs{client.Nick, chanName, modes, args})
+		irc.Send(&IrcChannelCreationTime{client.Nick, chanName, uint64(channel.Ts.Unix())})
+	case *RehashIrcClientMessage:
+		if !ircd.CheckPrivilege(client, irc, PrivRehash) {
+			return
+		}
+		irc.Send(&IrcRehashing{client.Nick, ircd.configPath})
+		ircd.SendServerNotice(SnomaskOpers, "%s is rehashing the server config", client.Nick)
+		if err := ircd.Rehash(); err != nil && !strings.ContainsRune(irc.snomask, SnomaskOpers) {
+			// Operators watching +s o have already seen the errors.
+			for _, line := range strings.Split(err.Error(), "\n") {
+				irc.Send(&IrcServerNotice{client.Nick, fmt.Sprintf("Rehash: %s", line)})
+			}
+		}
+	case *MotdIrcClientMessage:
+		ircd.SendMotd(irc, client)
+	case *UserIrcClientMessage:
+		irc.Send(&IrcAlreadyRegistered{client.Nick})
+	case *InvalidIrcClientMessage:
+		ircd.SendInvalid(irc, client.Nick, event)
+	case *InputTooLongIrcClientMessage:
+		irc.Send(&IrcInputTooLong{client.Nick})
+	case *NoTextIrcClientMessage:
+		irc.Send(&IrcNoTextToSend{client.Nick})
+	case *DroppedIrcClientMessage:
+		break
+	case *UnknownIrcClientMessage:
+		irc.Send(&IrcUnknownCommand{client.Nick, event.Command})
+	}
+}
+
+// SendInvalid reports a message that failed to parse back to its sender.
+func (ircd *Ircd) SendInvalid(irc *IrcConnection, to string, msg *InvalidIrcClientMessage) {
+	switch {
+	case msg.Command == "NICK":
+		irc.Send(&IrcNoNicknameGiven{to})
+	case msg.Error != "":
+		irc.Send(&IrcServerNotice{to, fmt.Sprintf("%s: %s", msg.Command, msg.Error)})
+	default:
+		irc.Send(&IrcNeedMoreParams{to, msg.Command})
 	}
 }
 
 func (ircd *Ircd) InitiateConnection(target, host string, port uint16) {
 	// TODO: Move off the main ircd goroutine.
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", host, port), &tls.Config{
+	ircd.tlsLock.RLock()
+	config := &tls.Config{
 		Certificates: []tls.Certificate{ircd.tlsCert},
 		RootCAs:      ircd.tlsCaPool,
 		ServerName:   target,
-	})
+	}
+	ircd.tlsLock.RUnlock()
+	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", host, port), config)
 	if err != nil {
 		log.Printf("Error linking to %s:%d: %s", host, port, err)
 		return
@@ -234,14 +550,32 @@ func (ircd *Ircd) InitiateConnection(target, host string, port uint16) {
 }
 
 func (ircd *Ircd) ClientJoin(client *lib.Client, conn *IrcConnection, join *JoinIrcClientMessage) {
-	// Process all the joins.
-	for _, target := range join.Targets {
+	// Process all the joins. Keys pair up with targets by position.
+	for i, target := range join.Targets {
+		key := ""
+		if i < len(join.Keys) {
+			key = join.Keys[i]
+		}
 		first, _ := utf8.DecodeRuneInString(target)
 		if first != '#' {
-			// Bad channel.
-			panic("TODO: send appropriate error message")
+			conn.Send(&IrcNoSuchChannel{client.Nick, target})
+			continue
 		}
 		channelName, subnet, found, qualified := ircd.ExpandChannelRef(client, target[1:])
+		if !found || channelName == "" || len(fmt.Sprintf("#%s:%s", subnet.Name, channelName)) > MaxChannelLen {
+			conn.Send(&IrcNoSuchChannel{client.Nick, target})
+			continue
+		}
+		channel, exists := subnet.Channel[channelName]
+		if exists {
+			if _, member := channel.Member[client]; member {
+				continue
+			}
+			if refusal := ircd.CheckJoin(client, channel, key); refusal != nil {
+				conn.Send(refusal)
+				continue
+			}
+		}
 		if !qualified {
 			// TODO: Send +i message instead.
 			conn.Send(&IrcPartMessage{
@@ -251,10 +585,219 @@ func (ircd *Ircd) ClientJoin(client *lib.Client, conn *IrcConnection, join *Join
 			})
 		}
 
+		if !exists && key != "" {
+			// The creator's key becomes the channel key once the join
+			// comes back through OnChannelJoin.
+			conn.creatorKeys[FoldName(fmt.Sprintf("%s:%s", subnet.Name, channelName))] = key
+		}
+		ircd.node.JoinOrCreateChannel(client, subnet, channelName)
+	}
+}
+
+func (ircd *Ircd) ClientPart(client *lib.Client, conn *IrcConnection, part *PartIrcClientMessage) {
+	for _, target := range part.Targets {
+		channel, found := ircd.FindChannelByRef(client, target)
+		if !found {
+			conn.Send(&IrcNoSuchChannel{client.Nick, target})
+			continue
+		}
+		if _, member := channel.Member[client]; !member {
+			conn.Send(&IrcNotOnChannel{client.Nick, target})
+			continue
+		}
+
+		ircd.node.PartChannel(client, channel, part.Reason)
+	}
+}
+
+func (ircd *Ircd) ClientTopic(client *lib.Client, conn *IrcConnection, topic *TopicIrcClientMessage) {
+	channel, found := ircd.FindChannelByRef(client, topic.Target)
+	if !found {
+		conn.Send(&IrcNoSuchChannel{client.Nick, topic.Target})
+		return
+	}
+
+	if !topic.Set {
+		if !ChannelVisibleTo(channel, client) {
+			conn.Send(&IrcNotOnChannel{client.Nick, topic.Target})
+			return
+		}
+		if channel.Topic == "" {
+			conn.Send(&IrcNoTopicMessage{
+				To:      client.Nick,
+				Channel: fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+			})
+			return
+		}
+		ircd.SendTopic(conn, client, channel)
+		return
+	}
+
+	membership, member := channel.Member[client]
+	if !member {
+		conn.Send(&IrcNotOnChannel{client.Nick, topic.Target})
+		return
+	}
+	if channel.Mode.TopicLock && MembershipRank(membership) < RankHalfop {
+		conn.Send(&IrcChanOpPrivsNeeded{client.Nick, topic.Target})
+		return
+	}
+	text := topic.Topic
+	text = TruncateText(text, MaxTopicLen)
+	ircd.node.SetChannelTopic(client, channel, text)
+}
+
+func (ircd *Ircd) ClientNick(client *lib.Client, conn *IrcConnection, nick *NickIrcClientMessage) {
+	if nick.Nick == client.Nick {
+		return
+	}
+	if !ValidNick(nick.Nick) {
+		conn.Send(&IrcErroneousNickname{client.Nick, nick.Nick})
+		return
+	}
+	// A change in case only is allowed, since it collides with nobody else.
+	if existing, found := client.Subnet.Client[FoldName(nick.Nick)]; found && existing != client {
+		conn.Send(&IrcNickInUse{client.Nick, nick.Nick})
+		return
+	}
+	ircd.node.ChangeNick(client, nick.Nick)
+}
+
+func (ircd *Ircd) ClientNames(client *lib.Client, conn *IrcConnection, names *NamesIrcClientMessage) {
+	if len(names.Targets) == 0 {
+		// Listing every channel on the network isn't supported.
+		conn.Send(&IrcEndOfNames{client.Nick, "*"})
+		return
+	}
+	for _, target := range names.Targets {
+		channel, found := ircd.FindChannelByRef(client, target)
+		if !found || !ChannelVisibleTo(channel, client) {
+			conn.Send(&IrcEndOfNames{client.Nick, target})
+			continue
+		}
+		ircd.SendNames(conn, client, channel)
+	}
+}
+
+func (ircd *Ircd) ClientKick(client *lib.Client, conn *IrcConnection, kick *KickIrcClientMessage) {
+	channel, found := ircd.FindChannelByRef(client, kick.Channel)
+	if !found {
+		conn.Send(&IrcNoSuchChannel{client.Nick, kick.Channel})
+		return
+	}
+	membership, member := channel.Member[client]
+	if !member {
+		conn.Send(&IrcNotOnChannel{client.Nick, kick.Channel})
+		return
+	}
+	rank := MembershipRank(membership)
+	if rank < RankHalfop {
+		conn.Send(&IrcChanOpPrivsNeeded{client.Nick, kick.Channel})
+		return
+	}
+
+	reason := kick.Reason
+	if reason == "" {
+		reason = client.Nick
+	}
+	for _, ref := range kick.Targets {
+		target, found := ircd.FindClientByRef(client, ref)
 		if !found {
-			panic("TODO: send appropriate error message")
+			conn.Send(&IrcNoSuchNick{client.Nick, ref})
+			continue
+		}
+		targetMembership, onChannel := channel.Member[target]
+		if !onChannel {
+			conn.Send(&IrcUserNotInChannel{client.Nick, ref, kick.Channel})
+			continue
 		}
+		// Halfops may only kick members below them; everyone else may kick
+		// members of equal rank or below.
+		targetRank := MembershipRank(targetMembership)
+		if targetRank > rank || (rank == RankHalfop && targetRank >= RankHalfop) {
+			conn.Send(&IrcChanOpPrivsNeeded{client.Nick, kick.Channel})
+			continue
+		}
+		ircd.node.KickFromChannel(client, channel, target, reason)
+	}
+}
 
-		ircd.node.JoinOrCreateChannel(client, subnet, channelName)
+func (ircd *Ircd) ClientInvite(client *lib.Client, conn *IrcConnection, invite *InviteIrcClientMessage) {
+	target, found := ircd.FindClientByRef(client, invite.Nick)
+	if !found {
+		conn.Send(&IrcNoSuchNick{client.Nick, invite.Nick})
+		return
+	}
+	channel, found := ircd.FindChannelByRef(client, invite.Channel)
+	if !found {
+		conn.Send(&IrcNoSuchChannel{client.Nick, invite.Channel})
+		return
+	}
+	membership, member := channel.Member[client]
+	if !member {
+		conn.Send(&IrcNotOnChannel{client.Nick, invite.Channel})
+		return
+	}
+	if channel.Mode.InviteOnly && MembershipRank(membership) < RankHalfop {
+		conn.Send(&IrcChanOpPrivsNeeded{client.Nick, invite.Channel})
+		return
+	}
+	if _, onChannel := channel.Member[target]; onChannel {
+		conn.Send(&IrcUserOnChannel{client.Nick, invite.Nick, invite.Channel})
+		return
+	}
+
+	conn.Send(&IrcInviting{
+		To:      client.Nick,
+		Nick:    ircd.ClientAsSeenBy(target, client).Nick,
+		Channel: fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+	})
+	if target.Away != "" {
+		conn.Send(&IrcAway{client.Nick, ircd.ClientAsSeenBy(target, client).Nick, target.Away})
+	}
+	ircd.node.InviteToChannel(client, channel, target)
+}
+
+// ClientNotice delivers a NOTICE. Per RFC 1459 a NOTICE never triggers an
+// automatic reply, so every failure is silent.
+func (ircd *Ircd) ClientNotice(client *lib.Client, notice *NoticeIrcClientMessage) {
+	if strings.HasPrefix(notice.To, "#") {
+		channel, found := ircd.FindChannelByRef(client, notice.To)
+		if !found || ircd.CheckChannelMessage(client, channel) != nil {
+			return
+		}
+		ircd.node.Notice(client, nil, channel, notice.Message, RelayTags(client, notice.Tags))
+		return
+	}
+	to, found := ircd.FindClientByRef(client, notice.To)
+	if !found {
+		return
+	}
+	ircd.node.Notice(client, to, nil, notice.Message, RelayTags(client, notice.Tags))
+}
+
+func (ircd *Ircd) ClientTagMsg(client *lib.Client, conn *IrcConnection, tagmsg *TagMsgIrcClientMessage) {
+	if len(tagmsg.Tags) == 0 {
+		// Nothing would be delivered.
+		return
+	}
+	if strings.HasPrefix(tagmsg.To, "#") {
+		channel, found := ircd.FindChannelByRef(client, tagmsg.To)
+		if !found {
+			conn.Send(&IrcNoSuchChannel{client.Nick, tagmsg.To})
+			return
+		}
+		if refusal := ircd.CheckChannelMessage(client, channel); refusal != nil {
+			conn.Send(refusal)
+			return
+		}
+		ircd.node.TagMsg(client, nil, channel, RelayTags(client, tagmsg.Tags))
+		return
+	}
+	to, found := ircd.FindClientByRef(client, tagmsg.To)
+	if !found {
+		conn.Send(&IrcNoSuchNick{client.Nick, tagmsg.To})
+		return
 	}
+	ircd.node.TagMsg(client, to, nil, RelayTags(client, tagmsg.Tags))
 }
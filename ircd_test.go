@@ -0,0 +1,163 @@
+package main
+
+import (
+	"github.com/gossamer-irc/lib"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineRecorder collects what is written to a test connection.
+type lineRecorder struct {
+	lock sync.Mutex
+	buf  strings.Builder
+}
+
+func (rec *lineRecorder) Write(p []byte) (int, error) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	return rec.buf.Write(p)
+}
+
+func (rec *lineRecorder) Close() error {
+	return nil
+}
+
+// waitFor waits for a line containing each of want, in order, and returns
+// everything written so far.
+func (rec *lineRecorder) waitFor(t *testing.T, want ...string) string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec.lock.Lock()
+		out := rec.buf.String()
+		rec.lock.Unlock()
+		rest, found := out, true
+		for _, w := range want {
+			idx := strings.Index(rest, w)
+			if idx < 0 {
+				found = false
+				break
+			}
+			rest = rest[idx+len(w):]
+		}
+		if found {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q in %q", want, out)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// testNetwork returns an Ircd with a "main" subnet holding #chan, and a local
+// client on that subnet whose output is recorded.
+func testNetwork() (*Ircd, *lib.Client, *IrcConnection, *lineRecorder) {
+	ircd := testIrcd()
+	ircd.wg = &sync.WaitGroup{}
+	main := &lib.Subnet{
+		Name:    "main",
+		Client:  make(map[string]*lib.Client),
+		Channel: make(map[string]*lib.Channel),
+	}
+	ircd.node.Subnet = map[string]*lib.Subnet{"main": main}
+	ircd.node.DefaultSubnet = main
+	client := &lib.Client{Nick: "alice", Ident: "alice", Host: "192.0.2.1", Subnet: main}
+	main.Client["alice"] = client
+	main.Channel["chan"] = &lib.Channel{
+		Name:   "chan",
+		Subnet: main,
+		Member: make(map[*lib.Client]*lib.Membership),
+	}
+
+	rec := &lineRecorder{}
+	conn := &IrcConnection{
+		ircd:        ircd,
+		sendQ:       lib.NewSendQ(rec, SendQSize, ircd.wg),
+		caps:        make(CapSet),
+		creatorKeys: make(map[string]string),
+	}
+	ircd.clientByConn = map[*IrcConnection]*lib.Client{conn: client}
+	ircd.connByClient = map[*lib.Client]*IrcConnection{client: conn}
+	ircd.streams = make(map[*IrcConnection][]IrcMessage)
+	return ircd, client, conn, rec
+}
+
+func TestChannelModeListQuery(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"#chan", []string{"367 alice #main:chan *!*@bad.example", "368 alice #main:chan"}},
+		{"#main:chan", []string{"367 alice #main:chan *!*@bad.example", "368 alice #main:chan"}},
+		{"#other", []string{"403 alice #other"}},
+		{"#nowhere:chan", []string{"403 alice #nowhere:chan"}},
+	}
+	for _, test := range tests {
+		ircd, client, conn, rec := testNetwork()
+		ircd.node.Subnet["main"].Channel["chan"].Ban = []lib.ListEntry{{Mask: "*!*@bad.example", SetBy: "op", SetAt: time.Now()}}
+		ircd.Handle(conn, client, &ChannelModeChangeIrcClientMessage{Target: test.target, Mode: "+b"})
+		rec.waitFor(t, test.want...)
+	}
+}
+
+func TestChannelModeListQueryHidden(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   lib.ChannelMode
+		member bool
+		want   string
+	}{
+		{"secret", lib.ChannelMode{Secret: true}, false, "442 alice #chan"},
+		{"private", lib.ChannelMode{Private: true}, false, "442 alice #chan"},
+		{"secret member", lib.ChannelMode{Secret: true}, true, "368 alice #main:chan"},
+		{"public", lib.ChannelMode{}, false, "368 alice #main:chan"},
+	}
+	for _, test := range tests {
+		ircd, client, conn, rec := testNetwork()
+		channel := ircd.node.Subnet["main"].Channel["chan"]
+		channel.Mode = test.mode
+		if test.member {
+			channel.Member[client] = &lib.Membership{}
+		}
+		ircd.Handle(conn, client, &ChannelModeChangeIrcClientMessage{Target: "#chan", Mode: "+b"})
+		if out := rec.waitFor(t, test.want); !test.member && test.mode != (lib.ChannelMode{}) && strings.Contains(out, "368") {
+			t.Errorf("%s: list sent to a non-member: %q", test.name, out)
+		}
+	}
+}
+
+func TestNoticeNeverReplies(t *testing.T) {
+	lines := []string{
+		"NOTICE",
+		"NOTICE bob",
+		"NOTICE bob :",
+		"NOTICE nobody :hi",
+		"NOTICE #nowhere :hi",
+		"NOTICE #chan :hi",
+	}
+	for _, line := range lines {
+		generic, valid := ParseIrc(line)
+		if !valid {
+			t.Fatalf("ParseIrc(%q) failed", line)
+		}
+		msg := InterpretIrc(generic)
+
+		ircd, client, conn, rec := testNetwork()
+		ircd.Handle(conn, client, msg)
+		ircd.Handle(conn, client, &PingIrcClientMessage{"done"})
+		if out := rec.waitFor(t, "PONG"); !strings.HasPrefix(out, "PONG") && !strings.HasPrefix(out, ":irc.example.net PONG") {
+			t.Errorf("%q got a reply: %q", line, out)
+		}
+
+		ircd, _, conn, rec = testNetwork()
+		pc := NewPendingClient(ircd, conn, ircd.node.DefaultSubnet, "192.0.2.2")
+		pc.Handle(msg)
+		pc.Handle(&PingIrcClientMessage{"done"})
+		if out := rec.waitFor(t, "PONG"); !strings.HasPrefix(out, "PONG") && !strings.HasPrefix(out, ":irc.example.net PONG") {
+			t.Errorf("%q from an unregistered client got a reply: %q", line, out)
+		}
+	}
+}
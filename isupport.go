@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Channel mode groups, in the order the CHANMODES token lists them.
+const (
+	ChannelModeList = iota
+	ChannelModeParam
+	ChannelModeSetParam
+	ChannelModeFlag
+)
+
+// channelModeTable lists the channel modes the daemon knows how to present,
+// and the CHANMODES group of each.
+var channelModeTable = []struct {
+	letter byte
+	group  int
+}{
+	{'I', ChannelModeList},
+	{'Q', ChannelModeList},
+	{'b', ChannelModeList},
+	{'e', ChannelModeList},
+	{'k', ChannelModeParam},
+	{'l', ChannelModeSetParam},
+	{'i', ChannelModeFlag},
+	{'m', ChannelModeFlag},
+	{'n', ChannelModeFlag},
+	{'p', ChannelModeFlag},
+	{'s', ChannelModeFlag},
+	{'t', ChannelModeFlag},
+}
+
+// Channel modes accepted by lib.ParseChannelModeString, grouped the way the
+// CHANMODES token expects: list modes, modes that always take a parameter,
+// modes that take a parameter only when set, and flags.
+var (
+	ChannelListModes     = acceptedChannelModes(ChannelModeList)
+	ChannelParamModes    = acceptedChannelModes(ChannelModeParam)
+	ChannelSetParamModes = acceptedChannelModes(ChannelModeSetParam)
+	ChannelFlagModes     = acceptedChannelModes(ChannelModeFlag)
+)
+
+// acceptedChannelModes returns the modes in a group that
+// lib.ParseChannelModeString turns into a change when set.
+func acceptedChannelModes(group int) string {
+	probe := &lib.Client{Nick: "probe"}
+	lookup := func(string) (*lib.Client, bool) {
+		return probe, true
+	}
+	modes := ""
+	for _, mode := range channelModeTable {
+		if mode.group != group {
+			continue
+		}
+		delta, memberDelta := lib.ParseChannelModeString("+"+string(mode.letter), []string{"probe"}, lookup)
+		if len(memberDelta) > 0 || !reflect.DeepEqual(delta, lib.ChannelModeDelta{}) {
+			modes += string(mode.letter)
+		}
+	}
+	return modes
+}
+
+const (
+	// Membership modes and their NAMES prefixes, highest rank first.
+	ChannelMemberModes    = "qaohv"
+	ChannelMemberPrefixes = "~&@%+"
+
+	// User modes: invisible, operator, server notices, wallops and cloaked.
+	UserModes = "ioswx"
+)
+
+const (
+	MaxChannelLen = 64
+	MaxTopicLen   = 390
+	MaxAwayLen    = 200
+
+	// MaxFeaturesPerLine caps the tokens in a single 005 line, as recommended
+	// by the ISUPPORT draft.
+	MaxFeaturesPerLine = 13
+)
+
+// FoldName case-folds a nick or subnet name the way CASEMAPPING=ascii
+// describes: only A-Z are folded.
+func FoldName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// TruncateText cuts text to at most max bytes without splitting a UTF-8
+// sequence.
+func TruncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return text[:max]
+}
+
+func sortModes(modes string) string {
+	b := []byte(modes)
+	sort.Slice(b, func(i, j int) bool {
+		return b[i] < b[j]
+	})
+	return string(b)
+}
+
+// SupportedUserModes lists user modes for 004.
+func SupportedUserModes() string {
+	if UserModes == "" {
+		// 004 has no way to express an empty field.
+		return "-"
+	}
+	return sortModes(UserModes)
+}
+
+// SupportedChannelModes lists every channel mode for 004.
+func SupportedChannelModes() string {
+	return sortModes(ChannelListModes + ChannelParamModes + ChannelSetParamModes + ChannelFlagModes + ChannelMemberModes)
+}
+
+// SupportedChannelParamModes lists the channel modes that take a parameter for 004.
+func SupportedChannelParamModes() string {
+	return sortModes(ChannelListModes + ChannelParamModes + ChannelSetParamModes + ChannelMemberModes)
+}
+
+// SupportedFeatures builds the RPL_ISUPPORT tokens for a client. Unqualified
+// channel and nick references resolve against the client's own subnet, which
+// is advertised in SUBNET alongside the separator used to qualify names.
+func (ircd *Ircd) SupportedFeatures(client *lib.Client) []IrcFeature {
+	return []IrcFeature{
+		{"NETWORK", ircd.node.NetworkName()},
+		{"CASEMAPPING", "ascii"},
+		{"CHANTYPES", "#"},
+		{"PREFIX", fmt.Sprintf("(%s)%s", ChannelMemberModes, ChannelMemberPrefixes)},
+		{"CHANMODES", fmt.Sprintf("%s,%s,%s,%s", ChannelListModes, ChannelParamModes, ChannelSetParamModes, ChannelFlagModes)},
+		{"NICKLEN", strconv.Itoa(MaxNickLen)},
+		{"CHANNELLEN", strconv.Itoa(MaxChannelLen)},
+		{"TOPICLEN", strconv.Itoa(MaxTopicLen)},
+		{"AWAYLEN", strconv.Itoa(MaxAwayLen)},
+		{"SUBNET", client.Subnet.Name},
+		{"SUBNETSEP", ":"},
+		{"WHOX", ""},
+		{"ELIST", "CMNTU"},
+		{"INVEX", "I"},
+		{"EXCEPTS", "e"},
+		{"MAXLIST", MaxListToken()},
+	}
+}
+
+// MaxListToken renders the MAXLIST value. Each list mode is limited on its
+// own, so each gets its own entry; "Ibe:100" would mean 100 shared between
+// them.
+func MaxListToken() string {
+	limits := make([]string, 0, len(ChannelListModes))
+	for _, letter := range ChannelListModes {
+		limits = append(limits, fmt.Sprintf("%c:%d", letter, MaxListEntries))
+	}
+	return strings.Join(limits, ",")
+}
+
+// SendSupportedFeatures sends RPL_ISUPPORT to a client.
+func (ircd *Ircd) SendSupportedFeatures(conn *IrcConnection, client *lib.Client) {
+	for _, line := range ircd.SplitFeatures(client.Nick, ircd.SupportedFeatures(client)) {
+		conn.Send(line)
+	}
+}
+
+// SplitFeatures spreads ISUPPORT tokens across as many 005 lines as needed
+// to stay within the token and line length limits.
+func (ircd *Ircd) SplitFeatures(nick string, features []IrcFeature) []*IrcWelcomeSupportedFeatures {
+	var lines []*IrcWelcomeSupportedFeatures
+	line := &IrcWelcomeSupportedFeatures{Nick: nick}
+	for _, feature := range features {
+		next := &IrcWelcomeSupportedFeatures{
+			Nick:    nick,
+			Feature: append(line.Feature[:len(line.Feature):len(line.Feature)], feature),
+		}
+		if len(line.Feature) > 0 && (len(next.Feature) > MaxFeaturesPerLine || len(next.ToIrc(ircd)) > MaxIrcLineLen) {
+			lines = append(lines, line)
+			next.Feature = []IrcFeature{feature}
+		}
+		line = next
+	}
+	if len(line.Feature) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"strings"
+	"testing"
+)
+
+// testIrcd returns an Ircd with just enough state to render messages.
+func testIrcd() *Ircd {
+	return &Ircd{
+		node: &lib.Node{
+			Me: &lib.Server{Name: "irc.example.net"},
+		},
+	}
+}
+
+func TestSplitFeatures(t *testing.T) {
+	ircd := testIrcd()
+	many := make([]IrcFeature, 30)
+	for i := range many {
+		many[i] = IrcFeature{fmt.Sprintf("TOKEN%d", i), ""}
+	}
+	long := make([]IrcFeature, 4)
+	for i := range long {
+		long[i] = IrcFeature{fmt.Sprintf("LONG%d", i), strings.Repeat("x", 200)}
+	}
+
+	tests := []struct {
+		name     string
+		features []IrcFeature
+		lines    int
+	}{
+		{"none", nil, 0},
+		{"one", many[:1], 1},
+		{"exactly one line of tokens", many[:MaxFeaturesPerLine], 1},
+		{"one token over", many[:MaxFeaturesPerLine+1], 2},
+		{"token count", many, 3},
+		{"line length", long, 2},
+	}
+	for _, test := range tests {
+		lines := ircd.SplitFeatures("nick", test.features)
+		if len(lines) != test.lines {
+			t.Errorf("%s: got %d lines, want %d", test.name, len(lines), test.lines)
+		}
+		var got []IrcFeature
+		for _, line := range lines {
+			if n := len(line.Feature); n == 0 || n > MaxFeaturesPerLine {
+				t.Errorf("%s: line has %d tokens", test.name, n)
+			}
+			if n := len(line.ToIrc(ircd)); n > MaxIrcLineLen {
+				t.Errorf("%s: line is %d bytes", test.name, n)
+			}
+			got = append(got, line.Feature...)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.features) {
+			t.Errorf("%s: tokens reordered or lost: %v", test.name, got)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel"},
+		{"héllo", 2, "h"},
+		{"héllo", 3, "hé"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+	}
+	for _, test := range tests {
+		if got := TruncateText(test.text, test.max); got != test.want {
+			t.Errorf("TruncateText(%q, %d) = %q, want %q", test.text, test.max, got, test.want)
+		}
+	}
+}
+
+func TestFoldName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Nick", "nick"},
+		{"[Nick]", "[nick]"},
+		{"ÄBC", "Äbc"},
+		{"already", "already"},
+	}
+	for _, test := range tests {
+		if got := FoldName(test.name); got != test.want {
+			t.Errorf("FoldName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMaxListToken(t *testing.T) {
+	token := MaxListToken()
+	limits := strings.Split(token, ",")
+	if len(limits) != len(ChannelListModes) {
+		t.Fatalf("MaxListToken() = %q, want one limit per list mode in %q", token, ChannelListModes)
+	}
+	for i, limit := range limits {
+		if want := fmt.Sprintf("%c:%d", ChannelListModes[i], MaxListEntries); limit != want {
+			t.Errorf("limit %d = %q, want %q", i, limit, want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 type LinkListener struct {
 	Ircd     *Ircd
 	Listener net.Listener
+	closed   chan struct{}
 }
 
 type LinkEvent struct {
@@ -18,24 +19,25 @@ type LinkEvent struct {
 	Server   string
 }
 
-func (ircd *Ircd) NewLinkListener(host string, port uint16) *LinkListener {
-	listener, err := tls.Listen("tcp", fmt.Sprintf("%s:%d", host, port), &tls.Config{
-		Certificates: []tls.Certificate{ircd.tlsCert},
-		RootCAs:      ircd.tlsCaPool,
-		ClientCAs:    ircd.tlsCaPool,
-		ServerName:   ircd.node.Me.Name,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-	})
+func (ircd *Ircd) NewLinkListener(host string, port uint16) (*LinkListener, error) {
+	listener, err := tls.Listen("tcp", fmt.Sprintf("%s:%d", host, port), ircd.ServerTlsConfig(tls.RequireAndVerifyClientCert))
 	if err != nil {
-		log.Fatalf("TLS Listen error: %s", err)
+		return nil, err
 	}
 	ll := &LinkListener{
 		Ircd:     ircd,
 		Listener: listener,
+		closed:   make(chan struct{}),
 	}
 	ircd.wg.Add(1)
 	go ll.Run()
-	return ll
+	return ll, nil
+}
+
+// Close stops accepting links. Established links are unaffected.
+func (ll *LinkListener) Close() error {
+	close(ll.closed)
+	return ll.Listener.Close()
 }
 
 func (ll *LinkListener) Run() {
@@ -43,7 +45,11 @@ func (ll *LinkListener) Run() {
 	for {
 		rawConn, err := ll.Listener.Accept()
 		if err != nil {
-			log.Printf("Accept() error: %s", err)
+			select {
+			case <-ll.closed:
+			default:
+				log.Printf("Accept() error: %s", err)
+			}
 			return
 		}
 
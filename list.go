@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListFilter is one ELIST condition from a LIST request.
+type ListFilter func(channel *lib.Channel) bool
+
+// ParseListFilter parses an ELIST condition: ">n" and "<n" on member count,
+// and "C>n", "C<n", "T>n", "T<n" on the minutes since the channel was created
+// or its topic set.
+func ParseListFilter(cond string) (ListFilter, bool) {
+	field := byte('U')
+	if len(cond) > 0 && (cond[0] == 'C' || cond[0] == 'T' || cond[0] == 'c' || cond[0] == 't') {
+		field = cond[0] &^ 0x20
+		cond = cond[1:]
+	}
+	if len(cond) < 2 || (cond[0] != '<' && cond[0] != '>') {
+		return nil, false
+	}
+	less := cond[0] == '<'
+	n, err := strconv.Atoi(cond[1:])
+	if err != nil {
+		return nil, false
+	}
+	compare := func(value int) bool {
+		if less {
+			return value < n
+		}
+		return value > n
+	}
+	switch field {
+	case 'C':
+		return func(channel *lib.Channel) bool {
+			return compare(int(time.Since(channel.Ts) / time.Minute))
+		}, true
+	case 'T':
+		return func(channel *lib.Channel) bool {
+			return channel.Topic != "" && compare(int(time.Since(channel.TopicTs)/time.Minute))
+		}, true
+	}
+	return func(channel *lib.Channel) bool {
+		return compare(len(channel.Member))
+	}, true
+}
+
+// listScope selects channels by subnet and channel name globs.
+type listScope struct {
+	subnet  string
+	channel string
+	negate  bool
+}
+
+func (scope listScope) matches(channel *lib.Channel) bool {
+	matched := MatchMask(scope.subnet, channel.Subnet.Name) && MatchMask(scope.channel, channel.Name)
+	return matched != scope.negate
+}
+
+func (ircd *Ircd) ClientList(client *lib.Client, conn *IrcConnection, list *ListIrcClientMessage) {
+	if ircd.streams[conn] != nil {
+		conn.Send(&IrcTryAgain{client.Nick, "LIST"})
+		return
+	}
+
+	var scopes, negated []listScope
+	var filters []ListFilter
+	for _, arg := range list.Targets {
+		negate := strings.HasPrefix(arg, "!")
+		mask := strings.TrimPrefix(arg, "!")
+		var scope listScope
+		switch {
+		case mask == "*":
+			// Every channel on every subnet.
+			scope = listScope{"*", "*", negate}
+		case strings.HasPrefix(mask, "#"):
+			scope = listScope{client.Subnet.Name, mask[1:], negate}
+			if parts := strings.SplitN(mask[1:], ":", 2); len(parts) == 2 {
+				scope.subnet, scope.channel = parts[0], parts[1]
+			}
+		default:
+			if filter, ok := ParseListFilter(arg); ok {
+				filters = append(filters, filter)
+			}
+			continue
+		}
+		if negate {
+			negated = append(negated, scope)
+		} else {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		// By default only the client's own subnet is listed.
+		scopes = append(scopes, listScope{client.Subnet.Name, "*", false})
+	}
+
+	// The replies are a snapshot, sent as the client's sendQ drains.
+	replies := make([]IrcMessage, 0)
+	replies = append(replies, &IrcListStart{client.Nick})
+	for _, subnet := range ircd.node.Subnet {
+	channels:
+		for _, channel := range subnet.Channel {
+			if !ChannelVisibleTo(channel, client) {
+				continue
+			}
+			included := false
+			for _, scope := range scopes {
+				if scope.matches(channel) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				continue
+			}
+			for _, scope := range negated {
+				if !scope.matches(channel) {
+					continue channels
+				}
+			}
+			for _, filter := range filters {
+				if !filter(channel) {
+					continue channels
+				}
+			}
+			replies = append(replies, &IrcListReply{
+				To:      client.Nick,
+				Channel: fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+				Users:   len(channel.Member),
+				Topic:   channel.Topic,
+			})
+		}
+	}
+	replies = append(replies, &IrcListEnd{client.Nick})
+	ircd.SendStream(conn, replies)
+}
+
+// StreamPollInterval is how often Run checks whether a sendQ has drained
+// enough to take more of a stream.
+const StreamPollInterval = 50 * time.Millisecond
+
+// SendStream sends a long run of replies to a connection without letting them
+// overflow its sendQ. As many as fit are sent now, and the rest from Run as
+// the sendQ drains. Messages sent with Send in the meantime go out ahead of
+// the rest of the stream. Callers check ircd.streams first, so a client can
+// only have one stream at a time.
+func (ircd *Ircd) SendStream(conn *IrcConnection, replies []IrcMessage) {
+	if !conn.sendFitting(&replies) {
+		ircd.streams[conn] = replies
+	}
+}
+
+// FlushStreams continues every stream in progress.
+func (ircd *Ircd) FlushStreams() {
+	for conn, replies := range ircd.streams {
+		if conn.sendFitting(&replies) {
+			delete(ircd.streams, conn)
+		} else {
+			ircd.streams[conn] = replies
+		}
+	}
+}
+
+// sendFitting sends replies from the front of the slice while they fit in
+// the sendQ, reporting whether it sent them all. Only Run sends to the sendQ,
+// so its length can't grow between the check and the send.
+func (irc *IrcConnection) sendFitting(replies *[]IrcMessage) bool {
+	for len(*replies) > 0 {
+		reply := (*replies)[0]
+		if irc.sendQ.Len()+len(irc.render(reply))+2 > SendQSize {
+			return false
+		}
+		irc.Send(reply)
+		*replies = (*replies)[1:]
+	}
+	return true
+}
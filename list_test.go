@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/gossamer-irc/lib"
+	"testing"
+	"time"
+)
+
+func TestParseListFilter(t *testing.T) {
+	members := make(map[*lib.Client]*lib.Membership)
+	for i := 0; i < 5; i++ {
+		members[&lib.Client{}] = &lib.Membership{}
+	}
+	channel := &lib.Channel{
+		Member:  members,
+		Ts:      time.Now().Add(-90 * time.Minute),
+		Topic:   "topic",
+		TopicTs: time.Now().Add(-30 * time.Minute),
+	}
+	noTopic := &lib.Channel{Member: members, Ts: channel.Ts}
+
+	tests := []struct {
+		cond    string
+		valid   bool
+		channel *lib.Channel
+		match   bool
+	}{
+		{">4", true, channel, true},
+		{">5", true, channel, false},
+		{"<6", true, channel, true},
+		{"<5", true, channel, false},
+		{"C>60", true, channel, true},
+		{"C<60", true, channel, false},
+		{"c<120", true, channel, true},
+		{"T<60", true, channel, true},
+		{"T>60", true, channel, false},
+		{"t>10", true, channel, true},
+		{"T<60", true, noTopic, false},
+		{"", false, nil, false},
+		{">", false, nil, false},
+		{"=5", false, nil, false},
+		{">x", false, nil, false},
+		{"C", false, nil, false},
+		{"U>5", false, nil, false},
+		{"#chan", false, nil, false},
+	}
+	for _, test := range tests {
+		filter, valid := ParseListFilter(test.cond)
+		if valid != test.valid {
+			t.Errorf("ParseListFilter(%q) valid = %v, want %v", test.cond, valid, test.valid)
+			continue
+		}
+		if valid && filter(test.channel) != test.match {
+			t.Errorf("ParseListFilter(%q) matched = %v, want %v", test.cond, !test.match, test.match)
+		}
+	}
+}
@@ -13,6 +13,7 @@ type Listener struct {
 	Tls      bool
 	Listener net.Listener
 	connChan chan<- *Connection
+	closed   chan struct{}
 }
 
 type Connection struct {
@@ -21,41 +22,44 @@ type Connection struct {
 	Err     error
 }
 
-func (ircd *Ircd) NewListener(host string, port uint16, tls bool) *Listener {
+func (ircd *Ircd) NewListener(host string, port uint16, useTls bool) (*Listener, error) {
+	netListener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, err
+	}
+	if useTls {
+		netListener = tls.NewListener(netListener, ircd.ServerTlsConfig(tls.VerifyClientCertIfGiven))
+	}
 	listener := &Listener{
 		Ircd:     ircd,
 		Host:     host,
 		Port:     port,
-		Tls:      tls,
+		Tls:      useTls,
+		Listener: netListener,
 		connChan: ircd.newConn,
+		closed:   make(chan struct{}),
 	}
 	go listener.run()
-	return listener
+	return listener, nil
+}
+
+// Close stops accepting connections. Connections already accepted are
+// unaffected.
+func (l *Listener) Close() error {
+	close(l.closed)
+	return l.Listener.Close()
 }
 
 func (l *Listener) run() {
-	netListener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", l.Host, l.Port))
-	if err != nil {
-		l.connChan <- &Connection{
-			Err: err,
-		}
-		return
-	}
-	if l.Tls {
-		netListener = tls.NewListener(netListener, &tls.Config{
-			Certificates: []tls.Certificate{l.Ircd.tlsCert},
-			RootCAs:      l.Ircd.tlsCaPool,
-			ClientCAs:    l.Ircd.tlsCaPool,
-			ServerName:   l.Ircd.node.Me.Name,
-			ClientAuth:   tls.VerifyClientCertIfGiven,
-		})
-	}
-	l.Listener = netListener
 	for {
 		conn, err := l.Listener.Accept()
 		if err != nil {
-			l.connChan <- &Connection{
-				Err: err,
+			select {
+			case <-l.closed:
+			default:
+				l.connChan <- &Connection{
+					Err: err,
+				}
 			}
 			return
 		}
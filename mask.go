@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"strings"
+)
+
+// MatchMask reports whether s matches a glob mask, where '*' matches any run
+// of characters and '?' matches exactly one. Matching is case-insensitive.
+func MatchMask(mask, s string) bool {
+	mask, s = FoldName(mask), FoldName(s)
+	m, i := 0, 0
+	starM, starI := -1, 0
+	for i < len(s) {
+		switch {
+		case m < len(mask) && mask[m] == '*':
+			starM, starI = m, i
+			m++
+		case m < len(mask) && (mask[m] == '?' || mask[m] == s[i]):
+			m++
+			i++
+		case starM >= 0:
+			// Let the last '*' swallow one more character and retry.
+			starI++
+			m, i = starM+1, starI
+		default:
+			return false
+		}
+	}
+	for m < len(mask) && mask[m] == '*' {
+		m++
+	}
+	return m == len(mask)
+}
+
+// SubnetMaskPrefix introduces an extended mask that matches every client on
+// the subnets matching the rest of the mask, as in "$s:guests".
+const SubnetMaskPrefix = "$s:"
+
+// MatchClient reports whether a nick!ident@host mask, set on a channel in
+// the given subnet, matches client. A bare nick only matches clients on that
+// subnet, the same way NickAsSeenBy leaves it bare; clients elsewhere only
+// match a mask qualified with their subnet, as in "guests:alice!*@*". The
+// mask is tried against both the real and the cloaked host, so a ban on
+// either holds whether or not the client has +x.
+func (ircd *Ircd) MatchClient(mask string, client *lib.Client, subnet *lib.Subnet) bool {
+	if strings.HasPrefix(mask, SubnetMaskPrefix) {
+		return MatchMask(mask[len(SubnetMaskPrefix):], client.Subnet.Name)
+	}
+	nicks := []string{fmt.Sprintf("%s:%s", client.Subnet.Name, client.Nick)}
+	if client.Subnet == subnet {
+		nicks = append(nicks, client.Nick)
+	}
+	for _, host := range []string{client.Host, CloakHost(ircd.cloakKey, client.Subnet.Name, client.Host)} {
+		for _, nick := range nicks {
+			if MatchMask(mask, fmt.Sprintf("%s!%s@%s", nick, client.Ident, host)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchesAnyMask reports whether any entry of a mask list on a channel in
+// the given subnet matches client.
+func (ircd *Ircd) MatchesAnyMask(client *lib.Client, subnet *lib.Subnet, list []lib.ListEntry) bool {
+	for _, entry := range list {
+		if ircd.MatchClient(entry.Mask, client, subnet) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/gossamer-irc/lib"
+	"testing"
+)
+
+func TestMatchMask(t *testing.T) {
+	tests := []struct {
+		mask, s string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"", "", true},
+		{"", "a", false},
+		{"alice", "alice", true},
+		{"alice", "ALICE", true},
+		{"ALICE", "alice", true},
+		{"alice", "alicex", false},
+		{"a?ice", "alice", true},
+		{"a?ice", "aice", false},
+		{"a*", "alice", true},
+		{"*e", "alice", true},
+		{"*e", "alicex", false},
+		{"a*e", "ae", true},
+		{"a*c*e", "alice", true},
+		{"a*c*e", "alicf", false},
+		{"**a**", "a", true},
+		{"*!*@*.example.net", "nick!ident@host.example.net", true},
+		{"*!*@*.example.net", "nick!ident@example.net", false},
+		{"*!ident@*", "nick!other@host", false},
+		{"?", "", false},
+	}
+	for _, test := range tests {
+		if got := MatchMask(test.mask, test.s); got != test.match {
+			t.Errorf("MatchMask(%q, %q) = %v, want %v", test.mask, test.s, got, test.match)
+		}
+	}
+}
+
+func TestMatchClient(t *testing.T) {
+	ircd := testIrcd()
+	ircd.cloakKey = "0123456789abcdef"
+	guests := &lib.Subnet{Name: "guests"}
+	main := &lib.Subnet{Name: "main"}
+	client := &lib.Client{
+		Nick:   "Alice",
+		Ident:  "ali",
+		Host:   "host.example.net",
+		Subnet: guests,
+	}
+	cloak := CloakHost(ircd.cloakKey, "guests", "host.example.net")
+	tests := []struct {
+		mask   string
+		subnet *lib.Subnet
+		match  bool
+	}{
+		{"*!*@*", guests, true},
+		{"alice!*@*", guests, true},
+		{"alice!ali@host.example.net", guests, true},
+		{"*!*@*.example.net", guests, true},
+		{"bob!*@*", guests, false},
+		{"*!bob@*", guests, false},
+		{"guests:alice!*@*", guests, true},
+		{"main:alice!*@*", guests, false},
+		{"*:*!*@*", guests, true},
+
+		// A bare nick set from another subnet means a client there.
+		{"alice!*@*", main, false},
+		{"alice!ali@host.example.net", main, false},
+		{"guests:alice!*@*", main, true},
+		{"*!*@*.example.net", main, true},
+
+		{"$s:guests", main, true},
+		{"$s:gue*", guests, true},
+		{"$s:main", main, false},
+		{"*!*@" + cloak, guests, true},
+		{"alice!*@" + cloak, main, false},
+		{"guests:alice!*@" + cloak, main, true},
+		{"*!*@*.cloak", guests, true},
+		{"*!*@" + CloakHost("another key", "guests", "host.example.net"), guests, false},
+	}
+	for _, test := range tests {
+		if got := ircd.MatchClient(test.mask, client, test.subnet); got != test.match {
+			t.Errorf("MatchClient(%q) from %s = %v, want %v", test.mask, test.subnet.Name, got, test.match)
+		}
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"github.com/gossamer-irc/lib"
 )
 
+// OnServerLink is called when a server joins the network. hub is the server
+// it linked to, or nil if it linked directly to this one.
 func (ircd *Ircd) OnServerLink(server *lib.Server, hub *lib.Server) {
+	if hub == nil {
+		ircd.SendServerNotice(SnomaskLinks, "Server %s linked", server.Name)
+		return
+	}
+	ircd.SendServerNotice(SnomaskLinks, "Server %s linked via %s", server.Name, hub.Name)
 }
 
-func (ircd *Ircd) OnPrivateMessage(from *lib.Client, to *lib.Client, message string) {
+func (ircd *Ircd) OnPrivateMessage(from *lib.Client, to *lib.Client, message string, tags map[string]string) {
 	conn, found := ircd.connByClient[to]
 	if !found {
 		return
@@ -17,6 +24,74 @@ func (ircd *Ircd) OnPrivateMessage(from *lib.Client, to *lib.Client, message str
 		From:    ircd.ClientAsSeenBy(from, to),
 		To:      to.Nick,
 		Message: message,
+		Tags:    tags,
+	})
+}
+
+// OnNotice delivers a NOTICE sent to either a client (to) or a channel; the
+// other is nil.
+func (ircd *Ircd) OnNotice(from *lib.Client, to *lib.Client, channel *lib.Channel, message string, tags map[string]string) {
+	if channel != nil {
+		ircd.ForEachLocalMember(channel, func(conn *IrcConnection, member *lib.Client, _ *lib.Membership) {
+			conn.Send(&IrcNoticeMessage{
+				From:    ircd.ClientAsSeenBy(from, member),
+				To:      fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+				Message: message,
+				Tags:    tags,
+			})
+		})
+		return
+	}
+	conn, found := ircd.connByClient[to]
+	if !found {
+		return
+	}
+	conn.Send(&IrcNoticeMessage{
+		From:    ircd.ClientAsSeenBy(from, to),
+		To:      to.Nick,
+		Message: message,
+		Tags:    tags,
+	})
+}
+
+// OnTagMsg delivers a TAGMSG sent to either a client (to) or a channel; the
+// other is nil. Only recipients that negotiated message-tags receive it.
+func (ircd *Ircd) OnTagMsg(from *lib.Client, to *lib.Client, channel *lib.Channel, tags map[string]string) {
+	if channel != nil {
+		ircd.ForEachLocalMember(channel, func(conn *IrcConnection, member *lib.Client, _ *lib.Membership) {
+			if !conn.caps.Has("message-tags") {
+				return
+			}
+			conn.Send(&IrcTagMessage{
+				From: ircd.ClientAsSeenBy(from, member),
+				To:   fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+				Tags: tags,
+			})
+		})
+		return
+	}
+	conn, found := ircd.connByClient[to]
+	if !found || !conn.caps.Has("message-tags") {
+		return
+	}
+	conn.Send(&IrcTagMessage{
+		From: ircd.ClientAsSeenBy(from, to),
+		To:   to.Nick,
+		Tags: tags,
+	})
+}
+
+// OnAway is called after client.Away has changed, whether it was set or
+// cleared. Peers that negotiated away-notify are told about it.
+func (ircd *Ircd) OnAway(client *lib.Client) {
+	ircd.ForEachLocalPeer(client, func(conn *IrcConnection, peer *lib.Client) {
+		if !conn.caps.Has("away-notify") {
+			return
+		}
+		conn.Send(&IrcAwayMessage{
+			From:    ircd.ClientAsSeenBy(client, peer),
+			Message: client.Away,
+		})
 	})
 }
 
@@ -32,14 +107,88 @@ func (ircd *Ircd) OnChannelJoin(channel *lib.Channel, client *lib.Client, member
 			ircd.SendNames(conn, client, channel)
 		}
 	})
+	if conn, local := ircd.connByClient[client]; local {
+		name := FoldName(fmt.Sprintf("%s:%s", channel.Subnet.Name, channel.Name))
+		key, found := conn.creatorKeys[name]
+		delete(conn.creatorKeys, name)
+		if found && len(channel.Member) == 1 {
+			// client created the channel, so its key becomes the channel key.
+			delta, memberDelta := lib.ParseChannelModeString("+k", []string{key}, func(name string) (*lib.Client, bool) {
+				return ircd.FindClientByRef(client, name)
+			})
+			ircd.node.ChangeChannelMode(client, channel, delta, memberDelta)
+		}
+	}
+}
+
+func (ircd *Ircd) OnChannelPart(channel *lib.Channel, client *lib.Client, reason string) {
+	ircd.ForEachLocalMember(channel, func(conn *IrcConnection, member *lib.Client, _ *lib.Membership) {
+		conn.Send(&IrcPartMessage{
+			From:    ircd.ClientAsSeenBy(client, member),
+			To:      fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+			Message: reason,
+		})
+	})
+}
+
+// OnChannelKick is called before target is removed from the channel, so the
+// victim sees their own KICK.
+func (ircd *Ircd) OnChannelKick(channel *lib.Channel, by *lib.Client, target *lib.Client, reason string) {
+	ircd.ForEachLocalMember(channel, func(conn *IrcConnection, member *lib.Client, _ *lib.Membership) {
+		from := ircd.node.Me.Name
+		if by != nil {
+			from = ircd.ClientAsSeenBy(by, member).String()
+		}
+		conn.Send(&IrcKickMessage{
+			From:    from,
+			To:      fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+			Target:  ircd.ClientAsSeenBy(target, member).Nick,
+			Message: reason,
+		})
+	})
+}
+
+// OnChannelInvite delivers an INVITE to its target if they are connected here,
+// and to local channel operators that negotiated invite-notify.
+func (ircd *Ircd) OnChannelInvite(channel *lib.Channel, by *lib.Client, target *lib.Client) {
+	notify := func(conn *IrcConnection, recipient *lib.Client) {
+		conn.Send(&IrcInviteMessage{
+			From:    ircd.ClientAsSeenBy(by, recipient),
+			Nick:    ircd.ClientAsSeenBy(target, recipient).Nick,
+			Channel: fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+		})
+	}
+	if conn, found := ircd.connByClient[target]; found {
+		notify(conn, target)
+	}
+	ircd.ForEachLocalMember(channel, func(conn *IrcConnection, member *lib.Client, membership *lib.Membership) {
+		if member != by && conn.caps.Has("invite-notify") && MembershipRank(membership) >= RankHalfop {
+			notify(conn, member)
+		}
+	})
 }
 
-func (ircd *Ircd) OnChannelMessage(from *lib.Client, to *lib.Channel, message string) {
+func (ircd *Ircd) OnChannelTopic(channel *lib.Channel, by *lib.Client, topic string) {
+	ircd.ForEachLocalMember(channel, func(conn *IrcConnection, member *lib.Client, _ *lib.Membership) {
+		from := ircd.node.Me.Name
+		if by != nil {
+			from = ircd.ClientAsSeenBy(by, member).String()
+		}
+		conn.Send(&IrcTopicMessage{
+			From:  from,
+			To:    fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name),
+			Topic: topic,
+		})
+	})
+}
+
+func (ircd *Ircd) OnChannelMessage(from *lib.Client, to *lib.Channel, message string, tags map[string]string) {
 	ircd.ForEachLocalMember(to, func(conn *IrcConnection, member *lib.Client, _ *lib.Membership) {
 		conn.Send(&IrcChannelMessage{
 			From:    ircd.ClientAsSeenBy(from, member),
 			To:      fmt.Sprintf("#%s:%s", to.Subnet.Name, to.Name),
 			Message: message,
+			Tags:    tags,
 		})
 	})
 }
@@ -59,3 +208,46 @@ func (ircd *Ircd) OnChannelModeChange(channel *lib.Channel, by *lib.Client, delt
 		})
 	})
 }
+
+func (ircd *Ircd) OnClientQuit(client *lib.Client, reason string) {
+	ircd.ForEachLocalPeer(client, func(conn *IrcConnection, peer *lib.Client) {
+		conn.Send(&IrcQuitMessage{
+			From:    ircd.ClientAsSeenBy(client, peer),
+			Message: reason,
+		})
+	})
+}
+
+// OnUserModeChange is called once client.Mode has been updated. The client
+// itself sees the change if it's connected here.
+func (ircd *Ircd) OnUserModeChange(client *lib.Client, old lib.UserMode) {
+	conn, found := ircd.connByClient[client]
+	if !found {
+		return
+	}
+	if !client.Mode.Oper {
+		conn.oper = nil
+		if conn.snomask != "" {
+			// Server notices are only for operators.
+			conn.snomask = ""
+			conn.Send(&IrcSnomaskIs{client.Nick, ""})
+		}
+	}
+	if delta := UserModeDelta(old, client.Mode); delta != "" {
+		conn.Send(&IrcUserModeMessage{ircd.ClientAsSeenBy(client, client), client.Nick, delta})
+	}
+}
+
+// OnNickChange is called once client.Nick has been updated to its new value.
+func (ircd *Ircd) OnNickChange(client *lib.Client, oldNick string) {
+	notify := func(conn *IrcConnection, peer *lib.Client) {
+		conn.Send(&IrcNickMessage{
+			From: IrcNIH{ircd.NickAsSeenBy(client.Subnet, oldNick, peer), client.Ident, ircd.HostAsSeenBy(client, peer)},
+			Nick: ircd.NickAsSeenBy(client.Subnet, client.Nick, peer),
+		})
+	}
+	if conn, found := ircd.connByClient[client]; found {
+		notify(conn, client)
+	}
+	ircd.ForEachLocalPeer(client, notify)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"strings"
+)
+
+// Operator privileges granted by an oper class.
+const (
+	PrivConnect = "connect"
+	PrivSquit   = "squit"
+	PrivKill    = "kill"
+	PrivKline   = "kline"
+	PrivRehash  = "rehash"
+	PrivDie     = "die"
+)
+
+var OperPrivileges = []string{PrivConnect, PrivSquit, PrivKill, PrivKline, PrivRehash, PrivDie}
+
+// OperClass is a named set of privileges shared by oper blocks.
+type OperClass struct {
+	Name       string
+	Privileges map[string]bool
+}
+
+// OperBlock describes one operator account. Fingerprint, if set, is the
+// SHA-256 fingerprint of a client certificate that must also be presented.
+type OperBlock struct {
+	Name         string
+	PasswordHash string
+	HostMask     string
+	Fingerprint  string
+	Class        *OperClass
+}
+
+// Can reports whether the block's class grants a privilege.
+func (block *OperBlock) Can(privilege string) bool {
+	return block.Class != nil && block.Class.Privileges[privilege]
+}
+
+func NewOperClass(name string, privileges []string) (*OperClass, error) {
+	class := &OperClass{
+		Name:       name,
+		Privileges: make(map[string]bool),
+	}
+	for _, privilege := range privileges {
+		privilege = strings.ToLower(privilege)
+		known := false
+		for _, priv := range OperPrivileges {
+			if priv == privilege {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown privilege %q in class %s", privilege, name)
+		}
+		class.Privileges[privilege] = true
+	}
+	return class, nil
+}
+
+// SetOpers replaces the oper blocks used by OPER. Operators who are already
+// logged in move to the new version of the block they used, taking up any
+// change to its class's privileges. Those whose block is gone or now names
+// another class lose operator status.
+func (ircd *Ircd) SetOpers(opers map[string]*OperBlock) {
+	ircd.opers = opers
+	for client, conn := range ircd.connByClient {
+		if conn.oper == nil {
+			continue
+		}
+		block, found := opers[conn.oper.Name]
+		if found && block.Class.Name == conn.oper.Class.Name {
+			conn.oper = block
+			continue
+		}
+		conn.Send(&IrcServerNotice{client.Nick, fmt.Sprintf("*** You are no longer an operator: oper block %s was removed or changed", conn.oper.Name)})
+		name := conn.oper.Name
+		conn.oper = nil
+		if client.Mode.Oper {
+			mode := client.Mode
+			mode.Oper = false
+			ircd.node.SetUserMode(client, mode)
+		}
+		ircd.SendServerNotice(SnomaskOpers, "%s (%s@%s) is no longer an operator: oper block %s was removed or changed", client.Nick, client.Ident, client.Host, name)
+	}
+}
+
+// ClientOper checks an OPER attempt. The password is checked off the Run
+// goroutine, and every failure counts towards MaxAuthFailures.
+func (ircd *Ircd) ClientOper(client *lib.Client, conn *IrcConnection, oper *OperIrcClientMessage) {
+	if conn.verifying {
+		conn.Send(&IrcTryAgain{client.Nick, "OPER"})
+		return
+	}
+	block, found := ircd.opers[oper.Name]
+	if found && !MatchMask(block.HostMask, fmt.Sprintf("%s@%s", client.Ident, client.Host)) {
+		found = false
+	}
+	if found && block.Fingerprint != "" {
+		cert := conn.PeerCertificate()
+		if cert == nil || CertificateFingerprint(cert) != block.Fingerprint {
+			found = false
+		}
+	}
+	if !found {
+		conn.Send(&IrcNoOperHost{client.Nick})
+		ircd.SendServerNotice(SnomaskOpers, "Failed OPER attempt by %s (%s@%s): no matching block for %s", client.Nick, client.Ident, client.Host, oper.Name)
+		ircd.AuthFailed(conn)
+		return
+	}
+
+	hash, password := block.PasswordHash, oper.Password
+	ircd.Verify(conn, func() bool {
+		return CheckPasswordHash(hash, password)
+	}, func(ok bool) {
+		if !ok {
+			conn.Send(&IrcPasswordMismatch{client.Nick})
+			ircd.SendServerNotice(SnomaskOpers, "Failed OPER attempt by %s (%s@%s): wrong password for %s", client.Nick, client.Ident, client.Host, oper.Name)
+			ircd.AuthFailed(conn)
+			return
+		}
+		if current := ircd.opers[block.Name]; current != block {
+			// A rehash replaced the block while the password was checked.
+			conn.Send(&IrcNoOperHost{client.Nick})
+			return
+		}
+		ircd.grantOper(client, conn, block)
+	})
+}
+
+func (ircd *Ircd) grantOper(client *lib.Client, conn *IrcConnection, block *OperBlock) {
+	conn.oper = block
+	if !client.Mode.Oper {
+		mode := client.Mode
+		mode.Oper = true
+		ircd.node.SetUserMode(client, mode)
+	}
+	conn.Send(&IrcYoureOper{client.Nick})
+	ircd.SendServerNotice(SnomaskOpers, "%s (%s@%s) is now an operator (%s)", client.Nick, client.Ident, client.Host, block.Name)
+}
+
+// CheckPrivilege reports whether a client may use a privileged command,
+// telling it why not if it can't.
+func (ircd *Ircd) CheckPrivilege(client *lib.Client, conn *IrcConnection, privilege string) bool {
+	if !client.Mode.Oper || conn.oper == nil {
+		conn.Send(&IrcNoPrivileges{client.Nick})
+		return false
+	}
+	if !conn.oper.Can(privilege) {
+		conn.Send(&IrcNoPrivs{client.Nick, privilege})
+		return false
+	}
+	return true
+}
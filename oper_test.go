@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewOperClass(t *testing.T) {
+	tests := []struct {
+		privileges []string
+		valid      bool
+		granted    []string
+	}{
+		{nil, true, nil},
+		{[]string{"connect"}, true, []string{PrivConnect}},
+		{[]string{"Rehash", "DIE"}, true, []string{PrivRehash, PrivDie}},
+		{OperPrivileges, true, OperPrivileges},
+		{[]string{"connect", "connect"}, true, []string{PrivConnect}},
+		{[]string{"connect", "fly"}, false, nil},
+		{[]string{""}, false, nil},
+	}
+	for _, test := range tests {
+		class, err := NewOperClass("test", test.privileges)
+		if (err == nil) != test.valid {
+			t.Errorf("NewOperClass(%v) error = %v, want valid %v", test.privileges, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if len(class.Privileges) != len(test.granted) {
+			t.Errorf("NewOperClass(%v) granted %v, want %v", test.privileges, class.Privileges, test.granted)
+		}
+		block := &OperBlock{Class: class}
+		for _, privilege := range test.granted {
+			if !block.Can(privilege) {
+				t.Errorf("NewOperClass(%v) didn't grant %s", test.privileges, privilege)
+			}
+		}
+	}
+	if (&OperBlock{}).Can(PrivDie) {
+		t.Errorf("a block without a class has privileges")
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"strings"
 )
 
+// MaxNickLen is the longest nickname a client may register.
+const MaxNickLen = 30
+
 type PendingClient struct {
 	Ircd   *Ircd
 	Conn   *IrcConnection
@@ -13,6 +16,21 @@ type PendingClient struct {
 	Ident  string
 	Gecos  string
 	Host   string
+
+	// Account is set once the client has logged in through SASL.
+	Account string
+
+	// capNegotiating holds registration open between CAP LS/REQ and CAP END.
+	capNegotiating bool
+
+	// State of an AUTHENTICATE exchange in progress. saslAborted is set when
+	// a payload grew too long, until its final chunk has been received.
+	// saslAttempt changes whenever an exchange ends, so the result of a
+	// password check can tell whether it still applies.
+	saslMech    string
+	saslBuf     strings.Builder
+	saslAborted bool
+	saslAttempt int
 }
 
 func NewPendingClient(ircd *Ircd, conn *IrcConnection, subnet *lib.Subnet, host string) *PendingClient {
@@ -24,16 +42,30 @@ func NewPendingClient(ircd *Ircd, conn *IrcConnection, subnet *lib.Subnet, host
 	}
 }
 
+// Target returns the name numerics should be addressed to, which is "*" until
+// a nickname has been accepted.
+func (pc *PendingClient) Target() string {
+	if pc.Nick == "" {
+		return "*"
+	}
+	return pc.Nick
+}
+
 func (pc *PendingClient) Handle(raw IrcClientMessage) {
 	switch msg := raw.(type) {
 	case *InvalidIrcClientMessage:
+		pc.Ircd.SendInvalid(pc.Conn, pc.Target(), msg)
 		break
 	case *NickIrcClientMessage:
+		if !ValidNick(msg.Nick) {
+			pc.Conn.Send(&IrcErroneousNickname{pc.Target(), msg.Nick})
+			return
+		}
 		// Check whether this nick is taken.
-		lnick := strings.ToLower(msg.Nick)
+		lnick := FoldName(msg.Nick)
 		_, found := pc.Subnet.Client[lnick]
 		if found {
-			pc.Conn.Send(&IrcNickInUse{msg.Nick})
+			pc.Conn.Send(&IrcNickInUse{pc.Target(), msg.Nick})
 			return
 		}
 		pc.Nick = msg.Nick
@@ -44,19 +76,61 @@ func (pc *PendingClient) Handle(raw IrcClientMessage) {
 		pc.Gecos = msg.Gecos
 		pc.CheckReady()
 		break
+	case *CapIrcClientMessage:
+		switch msg.Subcommand {
+		case "LS", "REQ":
+			pc.capNegotiating = true
+		case "END":
+			pc.capNegotiating = false
+		}
+		pc.Ircd.HandleCap(pc.Conn, pc.Target(), msg)
+		pc.CheckReady()
+	case *AuthenticateIrcClientMessage:
+		pc.HandleAuthenticate(msg)
+	case *QuitIrcClientMessage:
+		pc.Ircd.Disconnect(pc.Conn, quitReason(msg.Reason))
+	case *PingIrcClientMessage:
+		pc.Conn.Send(&IrcPongMessage{msg.Token})
+	case *PongIrcClientMessage:
+		break
+	case *NoticeIrcClientMessage, *DroppedIrcClientMessage:
+		// NOTICE never gets a reply, not even 451.
+		break
+	case *InputTooLongIrcClientMessage:
+		pc.Conn.Send(&IrcInputTooLong{pc.Target()})
+	default:
+		pc.Conn.Send(&IrcNotRegistered{pc.Target()})
 	}
 }
 
 func (pc *PendingClient) CheckReady() {
-	if pc.Nick == "" || pc.Ident == "" || pc.Gecos == "" {
+	if pc.Nick == "" || pc.Ident == "" || pc.Gecos == "" || pc.capNegotiating || pc.Conn.verifying {
 		return
 	}
-	lnick := strings.ToLower(pc.Nick)
+	lnick := FoldName(pc.Nick)
 	_, found := pc.Subnet.Client[lnick]
 	if found {
-		pc.Conn.Send(&IrcNickInUse{pc.Nick})
+		pc.Conn.Send(&IrcNickInUse{"*", pc.Nick})
 		pc.Nick = ""
 		return
 	}
 	pc.Ircd.AcceptPendingClient(pc)
 }
+
+// ValidNick checks a nickname against the RFC 2812 grammar. Colons are never
+// allowed since they separate a subnet from a nickname.
+func ValidNick(nick string) bool {
+	if nick == "" || len(nick) > MaxNickLen {
+		return false
+	}
+	for i, c := range nick {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case strings.ContainsRune("[]\\`_^{|}", c):
+		case i > 0 && (c >= '0' && c <= '9' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
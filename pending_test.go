@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidNick(t *testing.T) {
+	tests := []struct {
+		nick  string
+		valid bool
+	}{
+		{"alice", true},
+		{"Alice", true},
+		{"[alice]", true},
+		{"a\\b`c_d^e{f|g}", true},
+		{"alice2", true},
+		{"al-ice", true},
+		{strings.Repeat("a", MaxNickLen), true},
+		{"", false},
+		{strings.Repeat("a", MaxNickLen+1), false},
+		{"2alice", false},
+		{"-alice", false},
+		{"main:alice", false},
+		{"al ice", false},
+		{"al*ice", false},
+		{"#alice", false},
+		{"alicé", false},
+	}
+	for _, test := range tests {
+		if got := ValidNick(test.nick); got != test.valid {
+			t.Errorf("ValidNick(%q) = %v, want %v", test.nick, got, test.valid)
+		}
+	}
+}
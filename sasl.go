@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+)
+
+const (
+	// SaslChunkLen is the size of a full AUTHENTICATE payload chunk. A shorter
+	// chunk (or "+") ends the payload.
+	SaslChunkLen = 400
+
+	// MaxSaslPayloadLen bounds the decoded size of a whole SASL payload.
+	MaxSaslPayloadLen = 8192
+
+	SaslMechanisms = "PLAIN,EXTERNAL"
+)
+
+// HandleAuthenticate runs one step of a SASL exchange for a client that has
+// not yet registered.
+func (pc *PendingClient) HandleAuthenticate(msg *AuthenticateIrcClientMessage) {
+	if !pc.Conn.caps.Has("sasl") || pc.Ircd.accounts == nil {
+		pc.Conn.Send(&IrcSaslFail{pc.Target()})
+		return
+	}
+	if pc.Account != "" {
+		pc.Conn.Send(&IrcSaslAlready{pc.Target()})
+		return
+	}
+	if msg.Data == "*" {
+		pc.resetSasl()
+		pc.Conn.Send(&IrcSaslAborted{pc.Target()})
+		return
+	}
+	if pc.Conn.verifying {
+		// The payload is complete and its password is being checked, so
+		// there's nothing more to send. The check's result is discarded.
+		pc.resetSasl()
+		pc.Conn.Send(&IrcSaslFail{pc.Target()})
+		return
+	}
+
+	if pc.saslAborted {
+		// Swallow the rest of an oversized payload, up to and including its
+		// last chunk, so none of it is taken for a new mechanism.
+		if len(msg.Data) != SaslChunkLen {
+			pc.saslAborted = false
+		}
+		return
+	}
+
+	if pc.saslMech == "" {
+		// The first message picks the mechanism.
+		mech := strings.ToUpper(msg.Data)
+		if mech != "PLAIN" && mech != "EXTERNAL" {
+			pc.Conn.Send(&IrcSaslMechs{pc.Target(), SaslMechanisms})
+			pc.Conn.Send(&IrcSaslFail{pc.Target()})
+			return
+		}
+		if mech == "EXTERNAL" && pc.Conn.PeerCertificate() == nil {
+			pc.Conn.Send(&IrcSaslFail{pc.Target()})
+			return
+		}
+		pc.saslMech = mech
+		pc.Conn.Send(&IrcAuthenticateMessage{"+"})
+		return
+	}
+
+	if msg.Data != "+" {
+		pc.saslBuf.WriteString(msg.Data)
+	}
+	if len(msg.Data) == SaslChunkLen {
+		if pc.saslBuf.Len() > base64.StdEncoding.EncodedLen(MaxSaslPayloadLen) {
+			pc.resetSasl()
+			pc.saslAborted = true
+			pc.Conn.Send(&IrcSaslFail{pc.Target()})
+		}
+		// More chunks to come.
+		return
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(pc.saslBuf.String())
+	mech := pc.saslMech
+	pc.resetSasl()
+	if err != nil {
+		pc.Conn.Send(&IrcSaslFail{pc.Target()})
+		return
+	}
+
+	switch mech {
+	case "PLAIN":
+		pc.saslPlain(payload)
+	case "EXTERNAL":
+		account, ok := pc.saslExternal(payload)
+		pc.saslDone(pc.saslAttempt, account, ok)
+	}
+}
+
+// saslDone finishes the exchange started as attempt, logging the client in if
+// ok. The result of an exchange that has since been aborted is ignored,
+// though a failure still counts towards MaxAuthFailures.
+func (pc *PendingClient) saslDone(attempt int, account string, ok bool) {
+	if !ok && pc.Ircd.AuthFailed(pc.Conn) {
+		return
+	}
+	if attempt == pc.saslAttempt {
+		if !ok {
+			pc.Conn.Send(&IrcSaslFail{pc.Target()})
+		} else {
+			pc.Account = account
+			pc.Conn.Send(&IrcLoggedIn{
+				To:      pc.Target(),
+				NIH:     IrcNIH{pc.Target(), pc.identOrStar(), pc.Host},
+				Account: account,
+			})
+			pc.Conn.Send(&IrcSaslSuccess{pc.Target()})
+		}
+	}
+	pc.CheckReady()
+}
+
+// saslPlain checks a PLAIN payload of the form authzid NUL authcid NUL passwd.
+// Logging in as an account other than the authenticated one isn't supported.
+// The password is checked off the Run goroutine, since hashing it is slow.
+func (pc *PendingClient) saslPlain(payload []byte) {
+	attempt := pc.saslAttempt
+	parts := bytes.Split(payload, []byte{0})
+	if len(parts) != 3 {
+		pc.saslDone(attempt, "", false)
+		return
+	}
+	authzid, authcid, password := string(parts[0]), string(parts[1]), string(parts[2])
+	if authzid != "" && authzid != authcid {
+		pc.saslDone(attempt, "", false)
+		return
+	}
+	store := pc.Ircd.accounts
+	account := ""
+	pc.Ircd.Verify(pc.Conn, func() (ok bool) {
+		account, ok = store.CheckPassword(authcid, password)
+		return
+	}, func(ok bool) {
+		pc.saslDone(attempt, account, ok)
+	})
+}
+
+// saslExternal maps the connection's client certificate to the account its
+// fingerprint is bound to. An optional authzid must name that same account.
+func (pc *PendingClient) saslExternal(payload []byte) (string, bool) {
+	cert := pc.Conn.PeerCertificate()
+	if cert == nil {
+		return "", false
+	}
+	account, found := pc.Ircd.accounts.AccountForCertificate(CertificateFingerprint(cert))
+	if !found {
+		return "", false
+	}
+	if authzid := string(payload); authzid != "" && !strings.EqualFold(authzid, account) {
+		return "", false
+	}
+	return account, true
+}
+
+func (pc *PendingClient) resetSasl() {
+	pc.saslAttempt++
+	pc.saslMech = ""
+	pc.saslAborted = false
+	pc.saslBuf.Reset()
+}
+
+func (pc *PendingClient) identOrStar() string {
+	if pc.Ident == "" {
+		return "*"
+	}
+	return pc.Ident
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gossamer-irc/lib"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxTagsLen bounds the tag section of a line, including the leading '@' and
+// the trailing space. It is enforced separately from MaxIrcLineLen, which
+// only covers the rest of the line.
+const MaxTagsLen = 8191
+
+// IrcTags holds IRCv3 message tags. Tags without a value map to "".
+type IrcTags map[string]string
+
+var tagEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
+func unescapeTagValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		if i == len(value) {
+			// A trailing lone backslash is dropped.
+			break
+		}
+		switch value[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			// Covers "\\" as well as invalid escapes, which drop the backslash.
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// ValidTagKey reports whether key follows the IRCv3 grammar: an optional
+// '+', an optional vendor hostname followed by '/', and a name made of
+// letters, digits and hyphens.
+func ValidTagKey(key string) bool {
+	key = strings.TrimPrefix(key, "+")
+	if idx := strings.LastIndexByte(key, '/'); idx >= 0 {
+		vendor := key[:idx]
+		if vendor == "" {
+			return false
+		}
+		for i := 0; i < len(vendor); i++ {
+			if c := vendor[i]; !isTagNameByte(c) && c != '.' {
+				return false
+			}
+		}
+		key = key[idx+1:]
+	}
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if !isTagNameByte(key[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTagNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// ParseTags parses a tag section, without its leading '@'. Later occurrences
+// of a key replace earlier ones, and tags with invalid keys are dropped.
+func ParseTags(section string) IrcTags {
+	tags := make(IrcTags)
+	for _, tag := range strings.Split(section, ";") {
+		if tag == "" {
+			continue
+		}
+		kv := strings.SplitN(tag, "=", 2)
+		if !ValidTagKey(kv[0]) {
+			continue
+		}
+		if len(kv) == 2 {
+			tags[kv[0]] = unescapeTagValue(kv[1])
+		} else {
+			tags[kv[0]] = ""
+		}
+	}
+	return tags
+}
+
+// ClientOnly returns the subset of tags sent by a client for other clients,
+// which are the ones prefixed with '+'.
+func (tags IrcTags) ClientOnly() IrcTags {
+	var out IrcTags
+	for key, value := range tags {
+		if strings.HasPrefix(key, "+") {
+			if out == nil {
+				out = make(IrcTags)
+			}
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// String encodes the tags in wire format, without the leading '@'.
+func (tags IrcTags) String() string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if value := tags[key]; value != "" {
+			keys[i] = key + "=" + tagEscaper.Replace(value)
+		}
+	}
+	return strings.Join(keys, ";")
+}
+
+// serverTagCaps maps each tag the server adds to relayed messages to the
+// capability a client needs to receive it. Client-only tags and any tag not
+// listed here need message-tags.
+var serverTagCaps = map[string]string{
+	"time":    "server-time",
+	"account": "account-tag",
+}
+
+// RelayTags returns the tags to deliver with a message from a client: the
+// client-only tags it sent, plus a msgid, the time and the sender's account.
+// It's called where the message enters the network, so every server and
+// recipient sees the same msgid and time.
+func RelayTags(from *lib.Client, clientTags IrcTags) IrcTags {
+	tags := make(IrcTags, len(clientTags)+3)
+	for key, value := range clientTags {
+		tags[key] = value
+	}
+	tags["msgid"] = NewMsgId()
+	tags["time"] = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	if from.Account != "" {
+		tags["account"] = from.Account
+	}
+	return tags
+}
+
+// NewMsgId returns a random message ID for the msgid tag.
+func NewMsgId() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// For returns the subset of tags a client with the given capabilities may
+// receive.
+func (tags IrcTags) For(caps CapSet) IrcTags {
+	var out IrcTags
+	for key, value := range tags {
+		needs, server := serverTagCaps[key]
+		if !server {
+			needs = "message-tags"
+		}
+		if !caps.Has(needs) {
+			continue
+		}
+		if out == nil {
+			out = make(IrcTags)
+		}
+		out[key] = value
+	}
+	return out
+}
+
+// Prefix returns the tag section to put in front of a line sent to a client
+// with the given capabilities, or "" if there is nothing to send.
+func (tags IrcTags) Prefix(caps CapSet) string {
+	tags = tags.For(caps)
+	if len(tags) == 0 {
+		return ""
+	}
+	return "@" + tags.String() + " "
+}
+
+// CheckLineLength reports whether a line's tag section and body are each
+// within their limits.
+func CheckLineLength(line string) bool {
+	tagLen := 0
+	if strings.HasPrefix(line, "@") {
+		tagLen = len(line)
+		if idx := strings.IndexByte(line, ' '); idx >= 0 {
+			tagLen = idx + 1
+		}
+	}
+	return tagLen <= MaxTagsLen && len(line)-tagLen <= MaxIrcLineLen
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/gossamer-irc/lib"
+	"reflect"
+	"testing"
+)
+
+func TestParseIrc(t *testing.T) {
+	tests := []struct {
+		line  string
+		valid bool
+		want  GenericIrcClientMessage
+	}{
+		{"PING", true, GenericIrcClientMessage{Command: "PING", Args: []string{}}},
+		{"privmsg bob :hello there", true, GenericIrcClientMessage{Command: "PRIVMSG", Args: []string{"bob", "hello there"}}},
+		{"PRIVMSG   bob   :", true, GenericIrcClientMessage{Command: "PRIVMSG", Args: []string{"bob", ""}}},
+		{":alice PRIVMSG bob :hi", true, GenericIrcClientMessage{Command: "PRIVMSG", Args: []string{"bob", "hi"}}},
+		{"MODE #c +o :x :y", true, GenericIrcClientMessage{Command: "MODE", Args: []string{"#c", "+o", "x :y"}}},
+		{"@+a=1;b TAGMSG bob", true, GenericIrcClientMessage{Tags: IrcTags{"+a": "1", "b": ""}, Command: "TAGMSG", Args: []string{"bob"}}},
+		{"", false, GenericIrcClientMessage{}},
+		{":alice", false, GenericIrcClientMessage{}},
+		{"@+a=1", false, GenericIrcClientMessage{}},
+	}
+	for _, test := range tests {
+		msg, valid := ParseIrc(test.line)
+		if valid != test.valid {
+			t.Errorf("ParseIrc(%q) valid = %v, want %v", test.line, valid, test.valid)
+			continue
+		}
+		if !valid {
+			continue
+		}
+		if msg.Command != test.want.Command || !reflect.DeepEqual(msg.Args, test.want.Args) || len(msg.Tags) != len(test.want.Tags) {
+			t.Errorf("ParseIrc(%q) = %+v, want %+v", test.line, *msg, test.want)
+			continue
+		}
+		for key, value := range test.want.Tags {
+			if msg.Tags[key] != value {
+				t.Errorf("ParseIrc(%q) tag %s = %q, want %q", test.line, key, msg.Tags[key], value)
+			}
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		section string
+		want    IrcTags
+	}{
+		{"", IrcTags{}},
+		{"a", IrcTags{"a": ""}},
+		{"a=", IrcTags{"a": ""}},
+		{"a=1;b=2", IrcTags{"a": "1", "b": "2"}},
+		{"a=1;a=2", IrcTags{"a": "2"}},
+		{";;a=1;", IrcTags{"a": "1"}},
+		{"+example.com/foo=bar", IrcTags{"+example.com/foo": "bar"}},
+		{"a=x\\:y\\sz", IrcTags{"a": "x;y z"}},
+		{"a=\\\\\\r\\n", IrcTags{"a": "\\\r\n"}},
+		{"a=\\b", IrcTags{"a": "b"}},
+		{"a=x\\", IrcTags{"a": "x"}},
+		{"a=1;b_c=2;/d=3;+=4", IrcTags{"a": "1"}},
+	}
+	for _, test := range tests {
+		if got := ParseTags(test.section); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseTags(%q) = %v, want %v", test.section, got, test.want)
+		}
+	}
+}
+
+func TestTagsRoundTrip(t *testing.T) {
+	tags := IrcTags{"+a": "semi;colon space\\back\r\n", "b": ""}
+	if got := ParseTags(tags.String()); !reflect.DeepEqual(got, tags) {
+		t.Errorf("round trip of %v gave %v", tags, got)
+	}
+}
+
+func TestValidTagKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"msgid", true},
+		{"+typing", true},
+		{"+draft/reply", true},
+		{"example.com/x-y", true},
+		{"+example.com/a1", true},
+		{"", false},
+		{"+", false},
+		{"a b", false},
+		{"a_b", false},
+		{"/a", false},
+		{"a/", false},
+		{"ex_ample.com/a", false},
+		{"+ü", false},
+	}
+	for _, test := range tests {
+		if got := ValidTagKey(test.key); got != test.valid {
+			t.Errorf("ValidTagKey(%q) = %v, want %v", test.key, got, test.valid)
+		}
+	}
+}
+
+func TestTagsFor(t *testing.T) {
+	tags := IrcTags{"+typing": "active", "msgid": "1", "time": "t", "account": "alice"}
+	tests := []struct {
+		caps []string
+		want IrcTags
+	}{
+		{nil, nil},
+		{[]string{"server-time"}, IrcTags{"time": "t"}},
+		{[]string{"account-tag"}, IrcTags{"account": "alice"}},
+		{[]string{"message-tags"}, IrcTags{"+typing": "active", "msgid": "1"}},
+		{[]string{"message-tags", "server-time", "account-tag"}, tags},
+	}
+	for _, test := range tests {
+		caps := make(CapSet)
+		for _, name := range test.caps {
+			caps[name] = true
+		}
+		if got := tags.For(caps); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("For(%v) = %v, want %v", test.caps, got, test.want)
+		}
+	}
+}
+
+func TestRelayTags(t *testing.T) {
+	client := &lib.Client{Account: "alice"}
+	tags := RelayTags(client, IrcTags{"+typing": "active"})
+	if tags["+typing"] != "active" || tags["account"] != "alice" || tags["msgid"] == "" || tags["time"] == "" {
+		t.Errorf("RelayTags = %v", tags)
+	}
+	if other := RelayTags(client, nil); other["msgid"] == tags["msgid"] {
+		t.Errorf("msgid %s repeated", tags["msgid"])
+	}
+	if _, found := RelayTags(&lib.Client{}, nil)["account"]; found {
+		t.Errorf("account tag set for a client that isn't logged in")
+	}
+}
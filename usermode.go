@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"net"
+	"strings"
+)
+
+// Server notice mask letters for user mode +s.
+const (
+	SnomaskClients = 'c'
+	SnomaskLinks   = 'l'
+	SnomaskOpers   = 'o'
+
+	ServerNoticeMasks = "clo"
+
+	// DefaultSnomask is used for +s given without a mask.
+	DefaultSnomask = ServerNoticeMasks
+)
+
+// userModeFlags maps each network-visible user mode letter to its field.
+var userModeFlags = []struct {
+	letter byte
+	flag   func(mode *lib.UserMode) *bool
+}{
+	{'i', func(mode *lib.UserMode) *bool { return &mode.Invisible }},
+	{'o', func(mode *lib.UserMode) *bool { return &mode.Oper }},
+	{'w', func(mode *lib.UserMode) *bool { return &mode.Wallops }},
+	{'x', func(mode *lib.UserMode) *bool { return &mode.Cloaked }},
+}
+
+// UserModeString renders a client's modes as sent in 221, including +s if it
+// has a server notice mask.
+func UserModeString(mode lib.UserMode, snomask string) string {
+	modes := "+"
+	for _, umode := range userModeFlags {
+		if *umode.flag(&mode) {
+			modes += string(umode.letter)
+		}
+		if umode.letter == 'o' && snomask != "" {
+			// Keep the letters in alphabetical order.
+			modes += "s"
+		}
+	}
+	return modes
+}
+
+// UserModeDelta renders the change from old to mode as a mode string, which
+// is empty if nothing changed.
+func UserModeDelta(old, mode lib.UserMode) string {
+	added, removed := "", ""
+	for _, umode := range userModeFlags {
+		was, is := *umode.flag(&old), *umode.flag(&mode)
+		if !was && is {
+			added += string(umode.letter)
+		} else if was && !is {
+			removed += string(umode.letter)
+		}
+	}
+	delta := ""
+	if added != "" {
+		delta += "+" + added
+	}
+	if removed != "" {
+		delta += "-" + removed
+	}
+	return delta
+}
+
+// ParseSnomask applies a server notice mask argument such as "+cl" or "-l"
+// to an existing mask. A mask with no sign is added.
+func ParseSnomask(current, arg string) string {
+	adding := true
+	for _, c := range arg {
+		switch {
+		case c == '+':
+			adding = true
+		case c == '-':
+			adding = false
+		case !strings.ContainsRune(ServerNoticeMasks, c):
+		case adding && !strings.ContainsRune(current, c):
+			current += string(c)
+		case !adding:
+			current = strings.Replace(current, string(c), "", -1)
+		}
+	}
+	return sortModes(current)
+}
+
+func (ircd *Ircd) ClientUserMode(client *lib.Client, conn *IrcConnection, umode *UserModeIrcClientMessage) {
+	target, found := ircd.FindClientByRef(client, umode.Target)
+	if !found {
+		conn.Send(&IrcNoSuchNick{client.Nick, umode.Target})
+		return
+	}
+	if target != client {
+		conn.Send(&IrcUsersDontMatch{client.Nick})
+		return
+	}
+	if umode.Mode == "" {
+		conn.Send(&IrcUserModeIs{client.Nick, UserModeString(client.Mode, conn.snomask)})
+		return
+	}
+
+	mode := client.Mode
+	snomask := conn.snomask
+	adding := true
+	unknown := false
+	args := umode.Arg
+	for i := 0; i < len(umode.Mode); i++ {
+		switch c := umode.Mode[i]; c {
+		case '+':
+			adding = true
+		case '-':
+			adding = false
+		case 'o':
+			// Operator status is only granted through OPER.
+			if !adding {
+				mode.Oper = false
+			}
+		case 's':
+			arg := DefaultSnomask
+			if len(args) > 0 {
+				arg, args = args[0], args[1:]
+			}
+			if adding && !client.Mode.Oper {
+				// The mask argument is still used up, so it isn't taken by
+				// a later mode.
+				continue
+			}
+			if !adding {
+				snomask = ""
+			} else {
+				snomask = ParseSnomask(snomask, arg)
+			}
+		default:
+			flagged := false
+			for _, flag := range userModeFlags {
+				if flag.letter == c {
+					*flag.flag(&mode) = adding
+					flagged = true
+				}
+			}
+			if !flagged {
+				unknown = true
+			}
+		}
+	}
+	if unknown {
+		conn.Send(&IrcUnknownModeFlag{client.Nick})
+	}
+
+	if snomask != conn.snomask {
+		conn.snomask = snomask
+		conn.Send(&IrcSnomaskIs{client.Nick, snomask})
+	}
+	if mode != client.Mode {
+		ircd.node.SetUserMode(client, mode)
+	}
+}
+
+// SendServerNotice sends a notice to every local operator whose server notice
+// mask includes the given letter.
+func (ircd *Ircd) SendServerNotice(mask rune, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	for client, conn := range ircd.connByClient {
+		if client.Mode.Oper && strings.ContainsRune(conn.snomask, mask) {
+			conn.Send(&IrcServerNotice{client.Nick, fmt.Sprintf("*** Notice -- %s", message)})
+		}
+	}
+}
+
+// CloakHost derives the host shown for a client with +x. It's an HMAC of the
+// subnet and real host under the network's cloak key, so every server on the
+// network computes the same cloak but it can't be reversed by hashing
+// candidate addresses. A port left on the host is ignored.
+func CloakHost(key, subnet, host string) string {
+	if ip, _, err := net.SplitHostPort(host); err == nil {
+		host = ip
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(subnet + "/" + host))
+	digest := hex.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("%s.%s.%s.cloak", digest[0:8], digest[8:16], digest[16:24])
+}
+
+// HostAsSeenBy returns client's host, or its cloak if it has +x and context
+// is neither the client itself nor an operator.
+func (ircd *Ircd) HostAsSeenBy(client, context *lib.Client) string {
+	if !client.Mode.Cloaked || client == context || (context != nil && context.Mode.Oper) {
+		return client.Host
+	}
+	return CloakHost(ircd.cloakKey, client.Subnet.Name, client.Host)
+}
+
+// VisibleTo reports whether target may be listed to client in WHO and NAMES.
+// Invisible clients are hidden from everyone who doesn't share a channel with
+// them, except operators.
+func (ircd *Ircd) VisibleTo(target, client *lib.Client) bool {
+	if !target.Mode.Invisible || target == client || client.Mode.Oper {
+		return true
+	}
+	for channel := range target.Member {
+		if _, member := client.Member[channel]; member {
+			return true
+		}
+	}
+	return false
+}
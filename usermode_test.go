@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/gossamer-irc/lib"
+	"strings"
+	"testing"
+)
+
+func TestParseSnomask(t *testing.T) {
+	tests := []struct {
+		current, arg string
+		want         string
+	}{
+		{"", "c", "c"},
+		{"", "+cl", "cl"},
+		{"", "lc", "cl"},
+		{"c", "+o", "co"},
+		{"clo", "-l", "co"},
+		{"clo", "-cl+l", "lo"},
+		{"c", "c", "c"},
+		{"", "xyz", ""},
+		{"c", "+x-c", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		if got := ParseSnomask(test.current, test.arg); got != test.want {
+			t.Errorf("ParseSnomask(%q, %q) = %q, want %q", test.current, test.arg, got, test.want)
+		}
+	}
+}
+
+func TestCloakHost(t *testing.T) {
+	const key = "0123456789abcdef"
+	cloak := CloakHost(key, "main", "192.0.2.1")
+	parts := strings.Split(cloak, ".")
+	if len(parts) != 4 || parts[3] != "cloak" || len(parts[0]) != 8 || len(parts[1]) != 8 || len(parts[2]) != 8 {
+		t.Errorf("CloakHost gave malformed %q", cloak)
+	}
+	tests := []struct {
+		name              string
+		key, subnet, host string
+		same              bool
+	}{
+		{"same inputs", key, "main", "192.0.2.1", true},
+		{"port ignored", key, "main", "192.0.2.1:6667", true},
+		{"other host", key, "main", "192.0.2.2", false},
+		{"other subnet", key, "guests", "192.0.2.1", false},
+		{"other key", "fedcba9876543210", "main", "192.0.2.1", false},
+	}
+	for _, test := range tests {
+		if got := CloakHost(test.key, test.subnet, test.host); (got == cloak) != test.same {
+			t.Errorf("%s: got %q against %q", test.name, got, cloak)
+		}
+	}
+	if v6 := CloakHost(key, "main", "[2001:db8::1]:6667"); v6 != CloakHost(key, "main", "2001:db8::1") {
+		t.Errorf("IPv6 port not ignored")
+	}
+}
+
+func TestHostAsSeenBy(t *testing.T) {
+	ircd := testIrcd()
+	ircd.cloakKey = "0123456789abcdef"
+	subnet := &lib.Subnet{Name: "main"}
+	cloaked := &lib.Client{Host: "192.0.2.1", Subnet: subnet, Mode: lib.UserMode{Cloaked: true}}
+	plain := &lib.Client{Host: "192.0.2.2", Subnet: subnet}
+	oper := &lib.Client{Host: "192.0.2.3", Subnet: subnet, Mode: lib.UserMode{Oper: true}}
+	cloak := CloakHost(ircd.cloakKey, "main", "192.0.2.1")
+
+	tests := []struct {
+		name            string
+		client, context *lib.Client
+		want            string
+	}{
+		{"uncloaked", plain, oper, "192.0.2.2"},
+		{"cloaked to a user", cloaked, plain, cloak},
+		{"cloaked to a server", cloaked, nil, cloak},
+		{"cloaked to itself", cloaked, cloaked, "192.0.2.1"},
+		{"cloaked to an operator", cloaked, oper, "192.0.2.1"},
+	}
+	for _, test := range tests {
+		if got := ircd.HostAsSeenBy(test.client, test.context); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	ircd := testIrcd()
+	shared, other := &lib.Channel{Name: "shared"}, &lib.Channel{Name: "other"}
+	hidden := &lib.Client{Mode: lib.UserMode{Invisible: true}, Member: map[*lib.Channel]*lib.Membership{shared: {}}}
+	friend := &lib.Client{Member: map[*lib.Channel]*lib.Membership{shared: {}}}
+	stranger := &lib.Client{Member: map[*lib.Channel]*lib.Membership{other: {}}}
+	oper := &lib.Client{Mode: lib.UserMode{Oper: true}}
+	plain := &lib.Client{}
+
+	tests := []struct {
+		name           string
+		target, client *lib.Client
+		want           bool
+	}{
+		{"visible user", plain, stranger, true},
+		{"invisible to itself", hidden, hidden, true},
+		{"invisible to an operator", hidden, oper, true},
+		{"invisible sharing a channel", hidden, friend, true},
+		{"invisible to a stranger", hidden, stranger, false},
+	}
+	for _, test := range tests {
+		if got := ircd.VisibleTo(test.target, test.client); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
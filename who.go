@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"strings"
+)
+
+// WhoxFields lists the WHOX field letters in the order their values appear
+// in a 354 reply.
+const WhoxFields = "tcuihsnfdlaor"
+
+// WhoxQuery is the field selection from a WHO request's "%fields,token" flag.
+type WhoxQuery struct {
+	Fields string
+	Token  string
+}
+
+func ParseWhox(flags string) (query *WhoxQuery) {
+	idx := strings.IndexByte(flags, '%')
+	if idx < 0 {
+		return nil
+	}
+	query = &WhoxQuery{}
+	spec := flags[idx+1:]
+	if comma := strings.IndexByte(spec, ','); comma >= 0 {
+		query.Token = spec[comma+1:]
+		spec = spec[:comma]
+	}
+	query.Fields = spec
+	return
+}
+
+func (ircd *Ircd) ClientWho(client *lib.Client, conn *IrcConnection, who *WhoIrcClientMessage) {
+	whox := ParseWhox(who.Flags)
+	opersOnly := strings.ContainsRune(strings.SplitN(who.Flags, "%", 2)[0], 'o')
+
+	send := func(target *lib.Client, channel *lib.Channel, membership *lib.Membership) {
+		if opersOnly && !target.Mode.Oper {
+			return
+		}
+		if channel != nil {
+			// Everyone on a channel the requester is in is visible to them.
+			if _, shared := channel.Member[client]; !shared && !ircd.VisibleTo(target, client) {
+				return
+			}
+		} else if !ircd.VisibleTo(target, client) {
+			return
+		}
+		ircd.SendWhoReply(conn, client, target, channel, membership, whox)
+	}
+
+	if strings.HasPrefix(who.Mask, "#") {
+		channel, found := ircd.FindChannelByRef(client, who.Mask)
+		if found && ChannelVisibleTo(channel, client) {
+			for target, membership := range channel.Member {
+				send(target, channel, membership)
+			}
+		}
+	} else {
+		mask := who.Mask
+		if mask == "" || mask == "0" {
+			mask = "*"
+		}
+		for _, subnet := range ircd.node.Subnet {
+			for _, target := range subnet.Client {
+				nick := ircd.NickAsSeenBy(target.Subnet, target.Nick, client)
+				host := ircd.HostAsSeenBy(target, client)
+				if MatchMask(mask, nick) || MatchMask(mask, target.Ident) || MatchMask(mask, host) || MatchMask(mask, target.Gecos) {
+					send(target, nil, nil)
+				}
+			}
+		}
+	}
+	conn.Send(&IrcEndOfWho{client.Nick, who.Mask})
+}
+
+// SendWhoReply sends a 352 about target, or a 354 with the requested fields
+// for a WHOX query. channel and membership are nil when the reply isn't about
+// a channel.
+func (ircd *Ircd) SendWhoReply(conn *IrcConnection, client, target *lib.Client, channel *lib.Channel, membership *lib.Membership, whox *WhoxQuery) {
+	nih := ircd.ClientAsSeenBy(target, client)
+	channelName := "*"
+	if channel != nil {
+		channelName = fmt.Sprintf("#%s:%s", channel.Subnet.Name, channel.Name)
+	}
+	server := ircd.node.Me.Name
+	hops := 0
+	if target.Server != nil && target.Server != ircd.node.Me {
+		server = target.Server.Name
+		hops = 1
+	}
+	flags := "H"
+	if target.Away != "" {
+		flags = "G"
+	}
+	if target.Mode.Oper {
+		flags += "*"
+	}
+	flags += PrefixFor(conn, membership)
+
+	if whox == nil {
+		conn.Send(&IrcWhoReply{
+			To:      client.Nick,
+			Channel: channelName,
+			NIH:     nih,
+			Server:  server,
+			Flags:   flags,
+			Hops:    hops,
+			Gecos:   target.Gecos,
+		})
+		return
+	}
+
+	fields := make([]string, 0, len(WhoxFields))
+	for _, field := range WhoxFields {
+		if !strings.ContainsRune(whox.Fields, field) {
+			continue
+		}
+		switch field {
+		case 't':
+			fields = append(fields, whox.Token)
+		case 'c':
+			fields = append(fields, channelName)
+		case 'u':
+			fields = append(fields, nih.Ident)
+		case 'i':
+			// Client addresses aren't disclosed.
+			fields = append(fields, "255.255.255.255")
+		case 'h':
+			fields = append(fields, nih.Host)
+		case 's':
+			fields = append(fields, server)
+		case 'n':
+			fields = append(fields, nih.Nick)
+		case 'f':
+			fields = append(fields, flags)
+		case 'd':
+			fields = append(fields, fmt.Sprintf("%d", hops))
+		case 'l':
+			idle, _, _ := ircd.IdleTimes(target)
+			fields = append(fields, fmt.Sprintf("%d", idle))
+		case 'a':
+			account := target.Account
+			if account == "" {
+				account = "0"
+			}
+			fields = append(fields, account)
+		case 'o':
+			fields = append(fields, "n/a")
+		case 'r':
+			fields = append(fields, ":"+target.Gecos)
+		}
+	}
+	conn.Send(&IrcWhoxReply{client.Nick, fields})
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseWhox(t *testing.T) {
+	tests := []struct {
+		flags string
+		want  *WhoxQuery
+	}{
+		{"", nil},
+		{"o", nil},
+		{"%", &WhoxQuery{}},
+		{"%cuhsnfdlaor", &WhoxQuery{Fields: "cuhsnfdlaor"}},
+		{"%tna,42", &WhoxQuery{Fields: "tna", Token: "42"}},
+		{"o%tn,1", &WhoxQuery{Fields: "tn", Token: "1"}},
+		{"%n,", &WhoxQuery{Fields: "n"}},
+		{"%,7", &WhoxQuery{Token: "7"}},
+	}
+	for _, test := range tests {
+		got := ParseWhox(test.flags)
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("ParseWhox(%q) = %+v, want %+v", test.flags, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gossamer-irc/lib"
+	"sort"
+	"time"
+)
+
+func (ircd *Ircd) ClientWhois(client *lib.Client, conn *IrcConnection, whois *WhoisIrcClientMessage) {
+	for _, ref := range whois.Targets {
+		target, found := ircd.FindClientByRef(client, ref)
+		if !found {
+			conn.Send(&IrcNoSuchNick{client.Nick, ref})
+			conn.Send(&IrcEndOfWhois{client.Nick, ref})
+			continue
+		}
+		ircd.SendWhois(conn, client, target)
+	}
+}
+
+// SendWhois answers a WHOIS about target. Everything except idle time comes
+// from state lib.Node replicates, so remote clients get the same replies as
+// local ones; idle time is only known for clients connected here.
+func (ircd *Ircd) SendWhois(conn *IrcConnection, client, target *lib.Client) {
+	nih := ircd.ClientAsSeenBy(target, client)
+	conn.Send(&IrcWhoisUser{client.Nick, nih, target.Gecos})
+	if target.Away != "" {
+		conn.Send(&IrcAway{client.Nick, nih.Nick, target.Away})
+	}
+
+	channels := make([]string, 0)
+	for channel, membership := range ircd.ChannelsOf(target) {
+		if channel.Mode.Secret && target != client {
+			if _, shared := channel.Member[client]; !shared {
+				continue
+			}
+		}
+		channels = append(channels, fmt.Sprintf("%s#%s:%s", PrefixFor(conn, membership), channel.Subnet.Name, channel.Name))
+	}
+	sort.Strings(channels)
+	line := IrcWhoisChannels{To: client.Nick, Nick: nih.Nick}
+	for _, name := range channels {
+		next := IrcWhoisChannels{To: client.Nick, Nick: nih.Nick, Channels: append(line.Channels, name)}
+		if len(line.Channels) > 0 && len(next.ToIrc(ircd)) > MaxIrcLineLen {
+			conn.Send(&line)
+			next.Channels = []string{name}
+		}
+		line = next
+	}
+	if len(line.Channels) > 0 {
+		conn.Send(&line)
+	}
+
+	if target.Server != nil {
+		conn.Send(&IrcWhoisServer{client.Nick, nih.Nick, target.Server.Name, target.Server.Desc})
+	}
+	if target.Mode.Oper {
+		conn.Send(&IrcWhoisOperator{client.Nick, nih.Nick})
+	}
+	if target.Secure {
+		conn.Send(&IrcWhoisSecure{client.Nick, nih.Nick})
+	}
+	if target.Account != "" {
+		conn.Send(&IrcWhoisAccount{client.Nick, nih.Nick, target.Account})
+	}
+	if idle, signon, known := ircd.IdleTimes(target); known {
+		conn.Send(&IrcWhoisIdle{
+			To:     client.Nick,
+			Nick:   nih.Nick,
+			Idle:   idle,
+			Signon: signon,
+		})
+	}
+	conn.Send(&IrcEndOfWhois{client.Nick, nih.Nick})
+}
+
+// IdleSyncInterval bounds how far behind other servers' idle time for a
+// local client may be.
+const IdleSyncInterval = time.Minute
+
+// MarkActive records that a local client has just sent a message to a user or
+// channel. lib carries the time to other servers when it's more than
+// IdleSyncInterval newer than the last one sent, so their idle times stay
+// close without a link message for every line.
+func (ircd *Ircd) MarkActive(irc *IrcConnection, client *lib.Client) {
+	now := time.Now()
+	irc.lastActive = now
+	if now.Sub(client.LastActive) >= IdleSyncInterval {
+		ircd.node.SetLastActive(client, now)
+	}
+}
+
+// IdleTimes returns the seconds a client has been idle and its signon time.
+// Local clients' times are exact. Remote ones come from lib, and aren't known
+// if the client's server didn't send them.
+func (ircd *Ircd) IdleTimes(client *lib.Client) (idle, signon uint64, known bool) {
+	if conn, local := ircd.connByClient[client]; local {
+		return uint64(time.Since(conn.lastActive) / time.Second), uint64(conn.signon.Unix()), true
+	}
+	if client.Signon.IsZero() {
+		return 0, 0, false
+	}
+	lastActive := client.LastActive
+	if lastActive.IsZero() {
+		lastActive = client.Signon
+	}
+	return uint64(time.Since(lastActive) / time.Second), uint64(client.Signon.Unix()), true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/gossamer-irc/lib"
+	"testing"
+	"time"
+)
+
+func TestIdleTimes(t *testing.T) {
+	ircd := testIrcd()
+	signon := time.Now().Add(-time.Hour)
+	local := &lib.Client{}
+	ircd.connByClient = map[*lib.Client]*IrcConnection{
+		local: {signon: signon, lastActive: time.Now().Add(-10 * time.Second)},
+	}
+	tests := []struct {
+		name   string
+		client *lib.Client
+		idle   uint64
+		known  bool
+	}{
+		{"local", local, 10, true},
+		{"remote", &lib.Client{Signon: signon, LastActive: time.Now().Add(-5 * time.Minute)}, 300, true},
+		{"remote never active", &lib.Client{Signon: signon}, 3600, true},
+		{"remote without times", &lib.Client{}, 0, false},
+	}
+	for _, test := range tests {
+		idle, gotSignon, known := ircd.IdleTimes(test.client)
+		if known != test.known {
+			t.Errorf("%s: known = %v, want %v", test.name, known, test.known)
+			continue
+		}
+		if !known {
+			continue
+		}
+		if idle < test.idle || idle > test.idle+1 {
+			t.Errorf("%s: idle = %d, want %d", test.name, idle, test.idle)
+		}
+		if gotSignon != uint64(signon.Unix()) {
+			t.Errorf("%s: signon = %d, want %d", test.name, gotSignon, signon.Unix())
+		}
+	}
+}